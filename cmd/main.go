@@ -2,19 +2,39 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/oklog/run"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 
+	"github.com/angelnu/gateway-admision-controller/internal/certbootstrap"
+	"github.com/angelnu/gateway-admision-controller/internal/certwatcher"
 	cmdConfig "github.com/angelnu/gateway-admision-controller/internal/config"
+	"github.com/angelnu/gateway-admision-controller/internal/health"
+	"github.com/angelnu/gateway-admision-controller/internal/http/admin"
+	"github.com/angelnu/gateway-admision-controller/internal/http/clientauth"
+	"github.com/angelnu/gateway-admision-controller/internal/http/inflight"
 	"github.com/angelnu/gateway-admision-controller/internal/http/webhook"
+	"github.com/angelnu/gateway-admision-controller/internal/k8sversion"
 	"github.com/angelnu/gateway-admision-controller/internal/log"
+	"github.com/angelnu/gateway-admision-controller/internal/metrics"
+	gatewayPodMutator "github.com/angelnu/gateway-admision-controller/internal/mutation"
+	"github.com/angelnu/gateway-admision-controller/internal/resolv"
+	"github.com/angelnu/gateway-admision-controller/internal/tracing"
 )
 
 type config struct {
@@ -23,23 +43,113 @@ type config struct {
 	gateway  string
 }
 
+// effectiveConfig is served by the admin config endpoint.
+type effectiveConfig struct {
+	Version string `json:"version"`
+	// ConfigHash is the same on the replicas running with the same options.
+	ConfigHash string                           `json:"configHash"`
+	Config     cmdConfig.CmdConfig              `json:"config"`
+	Mutator    gatewayPodMutator.StatusSnapshot `json:"mutator"`
+}
+
+// certificateSource provides the webhook TLS certificate.
+type certificateSource interface {
+	GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	NotAfter() time.Time
+}
+
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
 func runApp() error {
 
 	cfg, err := cmdConfig.NewCmdConfig()
 	if err != nil {
 		return fmt.Errorf("could not get commandline configuration: %w", err)
 	}
+	if err := gatewayPodMutator.Validate(*cfg); err != nil {
+		return fmt.Errorf("could not get commandline configuration: %w", err)
+	}
+	if cfg.Command == cmdConfig.CommandValidateConfig {
+		for _, deprecation := range cfg.Deprecations {
+			fmt.Fprintln(os.Stderr, "warning:", deprecation)
+		}
+		fmt.Println("configuration is valid")
+		return nil
+	}
 
-	// Set up logger.
-	logrusLog := logrus.New()
-	logrusLogEntry := logrus.NewEntry(logrusLog).WithField("app", "gateway-admision-controller")
-	if cfg.Debug {
-		logrusLogEntry.Logger.SetLevel(logrus.DebugLevel)
+	// Set up logger, the levels are filtered by the leveled logger so they can change at runtime.
+	levels, err := log.ParseLevels(cfg.LogLevel)
+	if err != nil {
+		return fmt.Errorf("invalid --log-level: %w", err)
+	}
+	if cfg.Debug && !levels.Enabled("", log.LevelDebug) {
+		levels.Set("", log.LevelDebug)
 	}
-	if !cfg.Development {
-		logrusLogEntry.Logger.SetFormatter(&logrus.JSONFormatter{})
+	logFormat := cfg.LogFormat
+	if logFormat == "" {
+		logFormat = cmdConfig.LogFormatJSON
+		if cfg.Development {
+			logFormat = cmdConfig.LogFormatText
+		}
+	}
+	var backend log.Logger
+	switch cfg.LogBackend {
+	case cmdConfig.LogBackendSlog:
+		opts := &slog.HandlerOptions{Level: log.SlogLevelTrace, ReplaceAttr: log.SlogReplaceAttr}
+		var handler slog.Handler = slog.NewTextHandler(os.Stderr, opts)
+		if logFormat == cmdConfig.LogFormatJSON {
+			handler = slog.NewJSONHandler(os.Stderr, opts)
+		}
+		backend = log.NewSlog(handler).WithKV(log.KV{"app": "gateway-admision-controller"})
+	default:
+		logrusLog := logrus.New()
+		logrusLog.SetLevel(logrus.TraceLevel)
+		switch logFormat {
+		case cmdConfig.LogFormatJSON:
+			logrusLog.SetFormatter(&logrus.JSONFormatter{})
+		case cmdConfig.LogFormatLogfmt:
+			logrusLog.SetFormatter(&logrus.TextFormatter{DisableColors: true, FullTimestamp: true})
+		}
+		backend = log.NewLogrus(logrus.NewEntry(logrusLog).WithField("app", "gateway-admision-controller"))
+	}
+	logger := log.WithLevels(backend, levels).WithKV(log.KV{"version": cmdConfig.Version})
+	for _, deprecation := range cfg.Deprecations {
+		logger.Warningf("%s", deprecation)
+	}
+
+	// Set up metrics.
+	promReg := prometheus.NewRegistry()
+	promReg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	metricsRec := metrics.NewPrometheus(promReg)
+
+	// Set up tracing.
+	tracerProvider, err := tracing.New(context.Background(), tracing.Config{
+		Exporter:     cfg.TracingExporter,
+		OTLPEndpoint: cfg.TracingOTLPEndpoint,
+		OTLPInsecure: cfg.TracingOTLPInsecure,
+		SampleRatio:  cfg.TracingSampleRatio,
+		Version:      cmdConfig.Version,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Flush the pending spans.
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownDrainTimeout)
+		defer cancel()
+		if err := tracerProvider.Shutdown(ctx); err != nil {
+			logger.Errorf("could not flush the traces: %s", err)
+		}
+	}()
+
+	// Set up health checks, readiness fails while shutting down.
+	checker, err := health.New(health.Config{Logger: logger})
+	if err != nil {
+		return err
 	}
-	logger := log.NewLogrus(logrusLogEntry).WithKV(log.KV{"version": cmdConfig.Version})
 
 	// Prepare run entrypoints.
 	var g run.Group
@@ -55,61 +165,392 @@ func runApp() error {
 				select {
 				case s := <-sigC:
 					logger.Infof("signal %s received", s)
-					return nil
 				case <-exitC:
 					return nil
 				}
+
+				// Keep serving while the API server stops routing requests to this replica.
+				checker.SetDraining()
+				if cfg.ShutdownDelay > 0 {
+					logger.Infof("not ready, waiting %s before draining", cfg.ShutdownDelay)
+					select {
+					case <-time.After(cfg.ShutdownDelay):
+					case <-exitC:
+					}
+				}
+				return nil
+			},
+			func(_ error) {
+				close(exitC)
+			},
+		)
+	}
+
+	// SIGUSR1 toggles debug logging.
+	{
+		sigC := make(chan os.Signal, 1)
+		exitC := make(chan struct{})
+		signal.Notify(sigC, syscall.SIGUSR1)
+
+		g.Add(
+			func() error {
+				for {
+					select {
+					case <-sigC:
+						logger.Warningf("SIGUSR1 received, log level is now %s", levels.Toggle(log.LevelDebug))
+					case <-exitC:
+						return nil
+					}
+				}
 			},
 			func(_ error) {
+				signal.Stop(sigC)
 				close(exitC)
 			},
 		)
 	}
 
+	// API server version discovery for the sidecar auto mode.
+	var nativeSidecar gatewayPodMutator.NativeSidecarSupport
+	if cfg.SidecarModeOrDefault() == cmdConfig.SidecarModeAuto {
+		restConfig, err := rest.InClusterConfig()
+		if err != nil {
+			return fmt.Errorf("could not get the kubernetes client configuration: %w", err)
+		}
+		discoveryClient, err := discovery.NewDiscoveryClientForConfig(restConfig)
+		if err != nil {
+			return fmt.Errorf("could not create the discovery client: %w", err)
+		}
+
+		detector := k8sversion.NewDetector(discoveryClient, cfg.ServerVersionRefresh, logger)
+		if err := detector.Refresh(); err != nil {
+			logger.Warningf("%s - using regular sidecar containers until it is known", err)
+		}
+		nativeSidecar = detector
+
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(
+			func() error {
+				return detector.Run(ctx)
+			},
+			func(_ error) {
+				cancel()
+			},
+		)
+	}
+
+	// Shared with the admin endpoints to show what the mutator uses.
+	mutatorStatus := &gatewayPodMutator.Status{}
+
+	// Admin endpoints, served by their own HTTPS server or by the metrics server.
+	var adminHandler http.Handler
+	if cfg.AdminTokenFile != "" {
+		configHash := cfg.Hash()
+		token, err := admin.LoadToken(cfg.AdminTokenFile)
+		if err != nil {
+			return err
+		}
+		adminHandler, err = admin.New(admin.Config{
+			Token:  token,
+			Levels: levels,
+			EffectiveConfig: func() interface{} {
+				return effectiveConfig{
+					Version:    cmdConfig.Version,
+					ConfigHash: configHash,
+					Config:     cfg.Redacted(),
+					Mutator:    mutatorStatus.Snapshot(),
+				}
+			},
+			Logger: logger,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Metrics HTTP server.
+	{
+		logger := logger.WithKV(log.KV{"addr": cfg.MetricsListenAddr, "http-server": "metrics"})
+		mux := http.NewServeMux()
+		mux.Handle(cfg.MetricsPath, promhttp.HandlerFor(promReg, promhttp.HandlerOpts{}))
+		if adminHandler != nil && cfg.AdminListenAddr == "" {
+			logger.Warningf("admin endpoints served without TLS, their token is sent in cleartext")
+			mux.Handle(admin.PathPrefix, adminHandler)
+		}
+		server := http.Server{Addr: cfg.MetricsListenAddr, Handler: mux}
+
+		g.Add(
+			func() error {
+				logger.Infof("http server listening...")
+				return server.ListenAndServe()
+			},
+			func(_ error) {
+				logger.Infof("start draining connections")
+				ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownDrainTimeout)
+				defer cancel()
+
+				err := server.Shutdown(ctx)
+				if err != nil {
+					logger.Errorf("error while shutting down the server: %s", err)
+				} else {
+					logger.Infof("server stopped")
+				}
+			},
+		)
+	}
+
+	// TLS certificate, reloaded when the files change so rotations don't need a restart.
+	var certSource certificateSource
+	switch {
+	case cfg.TLSBootstrap.Enabled:
+		restConfig, err := rest.InClusterConfig()
+		if err != nil {
+			return fmt.Errorf("could not get the kubernetes client configuration: %w", err)
+		}
+		client, err := kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			return fmt.Errorf("could not create the kubernetes client: %w", err)
+		}
+		namespace := cfg.TLSBootstrap.Namespace
+		if namespace == "" {
+			data, err := os.ReadFile(serviceAccountNamespaceFile)
+			if err != nil {
+				return fmt.Errorf("could not get the pod namespace, set it with --tls-bootstrap-namespace: %w", err)
+			}
+			namespace = strings.TrimSpace(string(data))
+		}
+
+		bootstrapper, err := certbootstrap.New(certbootstrap.Config{
+			Client:            client,
+			Namespace:         namespace,
+			ServiceName:       cfg.TLSBootstrap.ServiceName,
+			SecretName:        cfg.TLSBootstrap.SecretName,
+			WebhookConfigName: cfg.TLSBootstrap.WebhookConfigName,
+			ClusterDomain:     cfg.ClusterDomain,
+			CertValidity:      cfg.TLSBootstrap.CertValidity,
+			RotateBefore:      cfg.TLSBootstrap.RotateBefore,
+			Interval:          cfg.TLSBootstrap.CheckInterval,
+			Logger:            logger,
+			Metrics:           metricsRec,
+		})
+		if err != nil {
+			return err
+		}
+		if err := bootstrapper.Ensure(context.Background()); err != nil {
+			return fmt.Errorf("could not bootstrap the TLS certificate: %w", err)
+		}
+		certSource = bootstrapper
+
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(
+			func() error {
+				return bootstrapper.Run(ctx)
+			},
+			func(_ error) {
+				cancel()
+			},
+		)
+
+	case cfg.TLSCertFilePath != "" && cfg.TLSKeyFilePath != "":
+		if info, err := os.Stat(cfg.TLSCertFilePath); err != nil || info.Size() == 0 {
+			logger.Errorf("Certificate file is missing or empty: %v", err)
+			return fmt.Errorf("certificate file %s is missing or empty", cfg.TLSCertFilePath)
+		}
+
+		certWatcher, err := certwatcher.New(certwatcher.Config{
+			CertFile: cfg.TLSCertFilePath,
+			KeyFile:  cfg.TLSKeyFilePath,
+			Interval: cfg.TLSReloadInterval,
+			Logger:   logger,
+			Metrics:  metricsRec,
+		})
+		if err != nil {
+			return fmt.Errorf("could not load the TLS certificate: %w", err)
+		}
+		certSource = certWatcher
+
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(
+			func() error {
+				return certWatcher.Run(ctx)
+			},
+			func(_ error) {
+				cancel()
+			},
+		)
+	}
+
+	// Admin HTTPS server.
+	if adminHandler != nil && cfg.AdminListenAddr != "" {
+		if certSource == nil {
+			return fmt.Errorf("the admin listener requires TLS")
+		}
+		logger := logger.WithKV(log.KV{"addr": cfg.AdminListenAddr, "http-server": "admin"})
+		mux := http.NewServeMux()
+		mux.Handle(admin.PathPrefix, adminHandler)
+		server := http.Server{
+			Addr:      cfg.AdminListenAddr,
+			Handler:   mux,
+			TLSConfig: &tls.Config{GetCertificate: certSource.GetCertificate},
+		}
+
+		g.Add(
+			func() error {
+				logger.Infof("https server listening...")
+				return server.ListenAndServeTLS("", "")
+			},
+			func(_ error) {
+				logger.Infof("start draining connections")
+				ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownDrainTimeout)
+				defer cancel()
+
+				err := server.Shutdown(ctx)
+				if err != nil {
+					logger.Errorf("error while shutting down the server: %s", err)
+				} else {
+					logger.Infof("server stopped")
+				}
+			},
+		)
+	}
+
+	// Readiness checks, liveness only reflects the process. The lookups only gate the
+	// readiness when DNS failures deny the pods, otherwise a resolver outage would remove
+	// every replica while the allow and last-known-good policies still admit pods.
+	if cfg.FailurePolicyDNS == cmdConfig.FailurePolicyDeny {
+		if cfg.Gateway != "" {
+			checker.AddReadinessCheck("gateway", health.ResolveCheck(cfg.Gateway))
+		}
+		if cfg.DNS != "" {
+			checker.AddReadinessCheck("dns", health.ResolveCheck(strings.Split(cfg.DNS, ",")...))
+		}
+	}
+	if certSource != nil {
+		checker.AddReadinessCheck("certificate", health.CertificateCheck(certSource.NotAfter))
+	}
+	checker.AddReadinessCheck("config", func(_ context.Context) error {
+		_, err := resolv.ConfigFile(cfg.ResolvConfPath)
+		return err
+	})
+
+	// Probes HTTP server, when not served by the webhook server.
+	if cfg.ProbeListenAddr != "" {
+		logger := logger.WithKV(log.KV{"addr": cfg.ProbeListenAddr, "http-server": "probes"})
+		mux := http.NewServeMux()
+		checker.Register(mux)
+		server := http.Server{Addr: cfg.ProbeListenAddr, Handler: mux}
+
+		g.Add(
+			func() error {
+				logger.Infof("http server listening...")
+				return server.ListenAndServe()
+			},
+			func(_ error) {
+				logger.Infof("start draining connections")
+				ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownDrainTimeout)
+				defer cancel()
+
+				err := server.Shutdown(ctx)
+				if err != nil {
+					logger.Errorf("error while shutting down the server: %s", err)
+				} else {
+					logger.Infof("server stopped")
+				}
+			},
+		)
+	}
+
 	// Webhook HTTP server.
 	{
 		logger := logger.WithKV(log.KV{"addr": cfg.WebhookListenAddr, "http-server": "webhooks"})
 
 		// Webhook handler.
 		wh, err := webhook.New(webhook.Config{
-			CmdConfig: *cfg,
-			Logger:    logger,
+			CmdConfig:      *cfg,
+			Logger:         logger,
+			NativeSidecar:  nativeSidecar,
+			MaxInFlight:    cfg.WebhookMaxInFlight,
+			Timeout:        cfg.WebhookAdmissionTimeout,
+			Draining:       checker.Draining,
+			Metrics:        metricsRec,
+			TracerProvider: tracerProvider,
+			MutatorStatus:  mutatorStatus,
 		})
 		if err != nil {
 			return fmt.Errorf("could not create webhooks handler: %w", err)
 		}
 
+		var tlsConfig *tls.Config
+		if certSource != nil {
+			tlsConfig = &tls.Config{
+				GetCertificate: certSource.GetCertificate,
+			}
+		}
+
+		// Client certificate verification, probes stay reachable without certificate.
+		if cfg.TLSClientCAFile != "" {
+			if tlsConfig == nil {
+				return fmt.Errorf("client certificate verification requires TLS")
+			}
+			clientCAs, err := clientauth.LoadCAs(cfg.TLSClientCAFile)
+			if err != nil {
+				return err
+			}
+			var allowedNames []string
+			if cfg.TLSClientAllowedNames != "" {
+				allowedNames = strings.Split(cfg.TLSClientAllowedNames, ",")
+			}
+			wh, err = clientauth.New(clientauth.Config{
+				ClientCAs:    clientCAs,
+				AllowedNames: allowedNames,
+				ExemptPaths:  []string{webhook.HealthPath},
+				Logger:       logger,
+				Metrics:      metricsRec,
+			}, wh)
+			if err != nil {
+				return fmt.Errorf("could not create client certificate verification: %w", err)
+			}
+			tlsConfig.ClientAuth = tls.RequestClientCert
+		}
+
 		mux := http.NewServeMux()
 		mux.Handle("/", wh)
-		server := http.Server{Addr: cfg.WebhookListenAddr, Handler: mux}
+		if cfg.ProbeListenAddr == "" {
+			// Registered on the router so they bypass the client certificate verification.
+			checker.Register(mux)
+		}
+		var tracker inflight.Tracker
+		server := http.Server{
+			Addr:         cfg.WebhookListenAddr,
+			Handler:      tracker.Handler(mux),
+			TLSConfig:    tlsConfig,
+			ReadTimeout:  cfg.WebhookReadTimeout,
+			WriteTimeout: cfg.WebhookWriteTimeout,
+			IdleTimeout:  cfg.WebhookIdleTimeout,
+		}
 
 		g.Add(
 			func() error {
-				if cfg.TLSCertFilePath == "" || cfg.TLSKeyFilePath == "" {
+				if tlsConfig == nil {
 					logger.Warningf("webhook running without TLS")
 					logger.Infof("http server listening...")
 					return server.ListenAndServe()
 				}
 
-				if info, err := os.Stat(cfg.TLSCertFilePath); err != nil || info.Size() == 0 {
-					logger.Errorf("Certificate file is missing or empty: %v", err)
-					return err
-				}
-
 				logger.Infof("https server listening...")
-				return server.ListenAndServeTLS(cfg.TLSCertFilePath, cfg.TLSKeyFilePath)
+				return server.ListenAndServeTLS("", "")
 			},
 			func(_ error) {
-				logger.Infof("start draining connections")
-				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				inFlight := tracker.InFlight()
+				logger.Infof("start draining connections with %d requests in flight", inFlight)
+				ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownDrainTimeout)
 				defer cancel()
 
-				err := server.Shutdown(ctx)
+				completed, aborted, err := tracker.Drain(ctx, &server)
 				if err != nil {
 					logger.Errorf("error while shutting down the server: %s", err)
-				} else {
-					logger.Infof("server stopped")
 				}
+				logger.WithKV(log.KV{"completed": completed, "aborted": aborted}).Infof("server stopped")
 			},
 		)
 	}
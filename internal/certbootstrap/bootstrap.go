@@ -0,0 +1,344 @@
+package certbootstrap
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/angelnu/gateway-admision-controller/internal/log"
+	"github.com/angelnu/gateway-admision-controller/internal/metrics"
+)
+
+const (
+	// Keys of the generated Secret
+	SECRET_CA_CERT_KEY = "ca.crt"
+	SECRET_CA_KEY_KEY  = "ca.key"
+	SECRET_CERT_KEY    = corev1.TLSCertKey
+	SECRET_KEY_KEY     = corev1.TLSPrivateKeyKey
+)
+
+// Config is the certificate bootstrap configuration.
+type Config struct {
+	Client kubernetes.Interface
+	// Namespace of the webhook Service and the Secret
+	Namespace   string
+	ServiceName string
+	SecretName  string
+	// WebhookConfigName is the MutatingWebhookConfiguration to patch with the CA
+	WebhookConfigName string
+	ClusterDomain     string
+	CAValidity        time.Duration
+	CertValidity      time.Duration
+	// RotateBefore is how long before expiry certificates are renewed
+	RotateBefore time.Duration
+	// Interval is how often the Secret and the caBundle are checked
+	Interval time.Duration
+	Logger   log.Logger
+	Metrics  metrics.Recorder
+}
+
+func (c *Config) defaults() error {
+
+	if c.Client == nil {
+		return fmt.Errorf("kubernetes client is required")
+	}
+
+	if c.Namespace == "" || c.ServiceName == "" || c.SecretName == "" || c.WebhookConfigName == "" {
+		return fmt.Errorf("namespace, service, secret and webhook configuration names are required")
+	}
+
+	if c.ClusterDomain == "" {
+		c.ClusterDomain = "cluster.local"
+	}
+
+	if c.CAValidity <= 0 {
+		c.CAValidity = 10 * 365 * 24 * time.Hour
+	}
+
+	if c.CertValidity <= 0 {
+		c.CertValidity = 365 * 24 * time.Hour
+	}
+
+	if c.RotateBefore <= 0 {
+		c.RotateBefore = 30 * 24 * time.Hour
+	}
+
+	if c.RotateBefore >= c.CertValidity {
+		return fmt.Errorf("rotate before (%s) must be shorter than the certificate validity (%s)", c.RotateBefore, c.CertValidity)
+	}
+
+	if c.Interval <= 0 {
+		c.Interval = time.Hour
+	}
+
+	if c.Logger == nil {
+		c.Logger = log.Dummy
+	}
+
+	if c.Metrics == nil {
+		c.Metrics = metrics.Dummy
+	}
+
+	return nil
+}
+
+// Bootstrapper keeps a self-signed serving certificate for the webhook in a Secret
+// and the CA in the caBundle of the MutatingWebhookConfiguration.
+type Bootstrapper struct {
+	cfg      Config
+	dnsNames []string
+	logger   log.Logger
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// New returns a new Bootstrapper. Call Ensure before serving.
+func New(config Config) (*Bootstrapper, error) {
+	err := config.defaults()
+	if err != nil {
+		return nil, fmt.Errorf("certificate bootstrap configuration is not valid: %w", err)
+	}
+
+	svc := config.ServiceName
+	ns := config.Namespace
+	return &Bootstrapper{
+		cfg: config,
+		dnsNames: []string{
+			fmt.Sprintf("%s.%s.svc", svc, ns),
+			svc,
+			fmt.Sprintf("%s.%s", svc, ns),
+			fmt.Sprintf("%s.%s.svc.%s", svc, ns, config.ClusterDomain),
+		},
+		logger: config.Logger.WithKV(log.KV{"service": "certbootstrap", "secret": config.SecretName}),
+	}, nil
+}
+
+// Ensure makes sure the Secret holds a valid certificate, the caBundle matches
+// its CA and the certificate is loaded for serving.
+func (b *Bootstrapper) Ensure(ctx context.Context) error {
+	ca, serving, err := b.ensureSecret(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := b.patchCABundle(ctx, ca.certPEM); err != nil {
+		return err
+	}
+
+	return b.load(serving)
+}
+
+// ensureSecret returns the certificates of the Secret, renewing them when needed. When
+// another replica writes the Secret first, its certificates are used.
+func (b *Bootstrapper) ensureSecret(ctx context.Context) (keyPair, keyPair, error) {
+	secrets := b.cfg.Client.CoreV1().Secrets(b.cfg.Namespace)
+
+	for attempt := 1; ; attempt++ {
+		secret, err := secrets.Get(ctx, b.cfg.SecretName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			secret = nil
+		} else if err != nil {
+			return keyPair{}, keyPair{}, fmt.Errorf("could not get secret: %w", err)
+		}
+
+		ca, serving, changed, err := b.renew(secret)
+		if err != nil {
+			return keyPair{}, keyPair{}, err
+		}
+		if !changed {
+			return ca, serving, nil
+		}
+
+		data := map[string][]byte{
+			SECRET_CA_CERT_KEY: ca.certPEM,
+			SECRET_CA_KEY_KEY:  ca.keyPEM,
+			SECRET_CERT_KEY:    serving.certPEM,
+			SECRET_KEY_KEY:     serving.keyPEM,
+		}
+		if secret == nil {
+			_, err = secrets.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      b.cfg.SecretName,
+					Namespace: b.cfg.Namespace,
+				},
+				Type: corev1.SecretTypeTLS,
+				Data: data,
+			}, metav1.CreateOptions{})
+		} else {
+			secret = secret.DeepCopy()
+			secret.Data = data
+			_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+		}
+		if (apierrors.IsAlreadyExists(err) || apierrors.IsConflict(err)) && attempt < 3 {
+			b.logger.Infof("another replica stored the certificate first, reading it again")
+			continue
+		}
+		if err != nil {
+			return keyPair{}, keyPair{}, fmt.Errorf("could not store the certificate in the secret: %w", err)
+		}
+		b.logger.Infof("stored new certificate for %v, expires %s", serving.cert.DNSNames, serving.cert.NotAfter.Format(time.RFC3339))
+		return ca, serving, nil
+	}
+}
+
+// renew returns the CA and serving certificates from the secret, renewing them when needed.
+func (b *Bootstrapper) renew(secret *corev1.Secret) (keyPair, keyPair, bool, error) {
+	renewAt := time.Now().Add(b.cfg.RotateBefore)
+
+	var ca, serving keyPair
+	caValid, servingValid := false, false
+	if secret != nil {
+		var err error
+		ca, err = parseKeyPair(secret.Data[SECRET_CA_CERT_KEY], secret.Data[SECRET_CA_KEY_KEY])
+		caValid = err == nil && ca.cert.IsCA && ca.cert.NotAfter.After(renewAt)
+		if caValid {
+			serving, err = parseKeyPair(secret.Data[SECRET_CERT_KEY], secret.Data[SECRET_KEY_KEY])
+			servingValid = err == nil && serving.cert.NotAfter.After(renewAt) &&
+				serving.cert.CheckSignatureFrom(ca.cert) == nil && b.coversDNSNames(serving.cert)
+		}
+	}
+	if servingValid {
+		return ca, serving, false, nil
+	}
+
+	var err error
+	if !caValid {
+		b.logger.Infof("generating a new CA")
+		ca, err = newCA(fmt.Sprintf("%s-ca", b.cfg.ServiceName), b.cfg.CAValidity)
+		if err != nil {
+			return keyPair{}, keyPair{}, false, err
+		}
+	}
+	b.logger.Infof("generating a new serving certificate")
+	serving, err = newServingCert(ca, b.dnsNames, b.cfg.CertValidity)
+	if err != nil {
+		return keyPair{}, keyPair{}, false, err
+	}
+	return ca, serving, true, nil
+}
+
+func (b *Bootstrapper) coversDNSNames(cert *x509.Certificate) bool {
+	for _, name := range b.dnsNames {
+		if cert.VerifyHostname(name) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// patchCABundle sets the CA in all the webhooks of the MutatingWebhookConfiguration.
+// The previous CAs are kept until they expire, other replicas may still serve
+// certificates signed by them until their next check.
+func (b *Bootstrapper) patchCABundle(ctx context.Context, caPEM []byte) error {
+	webhookConfigs := b.cfg.Client.AdmissionregistrationV1().MutatingWebhookConfigurations()
+
+	webhookConfig, err := webhookConfigs.Get(ctx, b.cfg.WebhookConfigName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("could not get mutating webhook configuration: %w", err)
+	}
+
+	type patchOperation struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value []byte `json:"value"`
+	}
+	var patch []patchOperation
+	now := time.Now()
+	for i := range webhookConfig.Webhooks {
+		current := webhookConfig.Webhooks[i].ClientConfig.CABundle
+		if bundle := caBundle(caPEM, current, now); !bytes.Equal(current, bundle) {
+			patch = append(patch, patchOperation{
+				Op:    "add",
+				Path:  fmt.Sprintf("/webhooks/%d/clientConfig/caBundle", i),
+				Value: bundle,
+			})
+		}
+	}
+	if len(patch) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	_, err = webhookConfigs.Patch(ctx, b.cfg.WebhookConfigName, types.JSONPatchType, data, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("could not patch the caBundle of mutating webhook configuration: %w", err)
+	}
+	b.logger.Infof("patched caBundle of %d webhooks in %s", len(patch), b.cfg.WebhookConfigName)
+	return nil
+}
+
+// load serves the certificate if it changed.
+func (b *Bootstrapper) load(serving keyPair) error {
+	b.mu.RLock()
+	unchanged := b.cert != nil && bytes.Equal(b.cert.Certificate[0], serving.cert.Raw)
+	b.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	cert, err := tls.X509KeyPair(serving.certPEM, serving.keyPEM)
+	if err != nil {
+		return fmt.Errorf("could not load certificate and key: %w", err)
+	}
+	cert.Leaf = serving.cert
+
+	b.mu.Lock()
+	b.cert = &cert
+	b.mu.Unlock()
+
+	b.logger.Infof("loaded TLS certificate for %v, expires %s", serving.cert.DNSNames, serving.cert.NotAfter.Format(time.RFC3339))
+	b.cfg.Metrics.SetTLSCertificateExpiry(serving.cert.NotAfter)
+	return nil
+}
+
+// Run checks the certificate until the context is done.
+func (b *Bootstrapper) Run(ctx context.Context) error {
+	ticker := time.NewTicker(b.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := b.Ensure(ctx); err != nil {
+				b.logger.Errorf("%s", err)
+			}
+		}
+	}
+}
+
+// GetCertificate returns the current certificate, to be used in tls.Config.
+func (b *Bootstrapper) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.cert == nil {
+		return nil, fmt.Errorf("certificate not bootstrapped yet")
+	}
+	return b.cert, nil
+}
+
+// NotAfter returns the expiry of the current certificate.
+func (b *Bootstrapper) NotAfter() time.Time {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.cert == nil {
+		return time.Time{}
+	}
+	return b.cert.Leaf.NotAfter
+}
@@ -0,0 +1,263 @@
+package certbootstrap_test
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/angelnu/gateway-admision-controller/internal/certbootstrap"
+)
+
+const (
+	testNamespace         = "gateway-system"
+	testServiceName       = "gateway-admision-controller"
+	testSecretName        = "gateway-admision-controller-tls"
+	testWebhookConfigName = "gateway-admision-controller"
+)
+
+func newTestClient() *fake.Clientset {
+	return fake.NewSimpleClientset(&admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: testWebhookConfigName},
+		Webhooks: []admissionregistrationv1.MutatingWebhook{
+			{Name: "setgateway.gateway-admision-controller.io"},
+			{Name: "other.gateway-admision-controller.io", ClientConfig: admissionregistrationv1.WebhookClientConfig{CABundle: []byte("old")}},
+		},
+	})
+}
+
+func newTestBootstrapper(t *testing.T, client *fake.Clientset, certValidity time.Duration, rotateBefore time.Duration) *certbootstrap.Bootstrapper {
+	b, err := certbootstrap.New(certbootstrap.Config{
+		Client:            client,
+		Namespace:         testNamespace,
+		ServiceName:       testServiceName,
+		SecretName:        testSecretName,
+		WebhookConfigName: testWebhookConfigName,
+		CertValidity:      certValidity,
+		RotateBefore:      rotateBefore,
+	})
+	require.NoError(t, err)
+	return b
+}
+
+func TestBootstrapperEnsure(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	client := newTestClient()
+	b := newTestBootstrapper(t, client, 0, 0)
+
+	require.NoError(b.Ensure(ctx))
+
+	// The secret holds the CA and the serving certificate
+	secret, err := client.CoreV1().Secrets(testNamespace).Get(ctx, testSecretName, metav1.GetOptions{})
+	require.NoError(err)
+	caPEM := secret.Data[certbootstrap.SECRET_CA_CERT_KEY]
+	require.NotEmpty(caPEM)
+	require.NotEmpty(secret.Data[certbootstrap.SECRET_CERT_KEY])
+
+	// All the webhooks trust the CA
+	webhookConfig, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, testWebhookConfigName, metav1.GetOptions{})
+	require.NoError(err)
+	for _, webhook := range webhookConfig.Webhooks {
+		assert.Equal(caPEM, webhook.ClientConfig.CABundle)
+	}
+
+	// The served certificate is valid for the service names
+	cert, err := b.GetCertificate(nil)
+	require.NoError(err)
+	roots := x509.NewCertPool()
+	require.True(roots.AppendCertsFromPEM(caPEM))
+	for _, name := range []string{
+		"gateway-admision-controller.gateway-system.svc",
+		"gateway-admision-controller.gateway-system.svc.cluster.local",
+	} {
+		_, err = cert.Leaf.Verify(x509.VerifyOptions{DNSName: name, Roots: roots})
+		assert.NoError(err, name)
+	}
+
+	// A second replica reuses the stored certificate
+	other := newTestBootstrapper(t, client, 0, 0)
+	require.NoError(other.Ensure(ctx))
+	otherCert, err := other.GetCertificate(nil)
+	require.NoError(err)
+	assert.Equal(cert.Certificate, otherCert.Certificate)
+}
+
+func TestBootstrapperClusterDomain(t *testing.T) {
+	require := require.New(t)
+
+	b, err := certbootstrap.New(certbootstrap.Config{
+		Client:            newTestClient(),
+		Namespace:         testNamespace,
+		ServiceName:       testServiceName,
+		SecretName:        testSecretName,
+		WebhookConfigName: testWebhookConfigName,
+		ClusterDomain:     "cluster.example.com",
+	})
+	require.NoError(err)
+	require.NoError(b.Ensure(context.Background()))
+
+	cert, err := b.GetCertificate(nil)
+	require.NoError(err)
+	assert.Equal(t, []string{
+		"gateway-admision-controller.gateway-system.svc",
+		"gateway-admision-controller",
+		"gateway-admision-controller.gateway-system",
+		"gateway-admision-controller.gateway-system.svc.cluster.example.com",
+	}, cert.Leaf.DNSNames)
+}
+
+func TestBootstrapperRotatesBeforeExpiry(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	client := newTestClient()
+	// The certificate is issued for 2h but must be renewed 3h before expiry
+	short := newTestBootstrapper(t, client, 2*time.Hour, time.Hour)
+	require.NoError(short.Ensure(ctx))
+	first, err := short.GetCertificate(nil)
+	require.NoError(err)
+	secret, err := client.CoreV1().Secrets(testNamespace).Get(ctx, testSecretName, metav1.GetOptions{})
+	require.NoError(err)
+	caPEM := secret.Data[certbootstrap.SECRET_CA_CERT_KEY]
+
+	b := newTestBootstrapper(t, client, 24*time.Hour, 3*time.Hour)
+	require.NoError(b.Ensure(ctx))
+	second, err := b.GetCertificate(nil)
+	require.NoError(err)
+
+	assert.NotEqual(first.Certificate, second.Certificate)
+	assert.True(second.Leaf.NotAfter.After(first.Leaf.NotAfter))
+
+	// The CA is still valid so it is kept
+	secret, err = client.CoreV1().Secrets(testNamespace).Get(ctx, testSecretName, metav1.GetOptions{})
+	require.NoError(err)
+	assert.Equal(caPEM, secret.Data[certbootstrap.SECRET_CA_CERT_KEY])
+}
+
+func TestBootstrapperKeepsTheOldCAInTheBundle(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	client := newTestClient()
+	// The CA expires in 2h and must be renewed 3h before expiry
+	old, err := certbootstrap.New(certbootstrap.Config{
+		Client:            client,
+		Namespace:         testNamespace,
+		ServiceName:       testServiceName,
+		SecretName:        testSecretName,
+		WebhookConfigName: testWebhookConfigName,
+		CAValidity:        2 * time.Hour,
+		CertValidity:      2 * time.Hour,
+		RotateBefore:      time.Hour,
+	})
+	require.NoError(err)
+	require.NoError(old.Ensure(ctx))
+	oldCert, err := old.GetCertificate(nil)
+	require.NoError(err)
+
+	b := newTestBootstrapper(t, client, 24*time.Hour, 3*time.Hour)
+	require.NoError(b.Ensure(ctx))
+	newCert, err := b.GetCertificate(nil)
+	require.NoError(err)
+
+	// Both the certificate still served by the other replica and the new one are trusted
+	webhookConfig, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, testWebhookConfigName, metav1.GetOptions{})
+	require.NoError(err)
+	for _, webhook := range webhookConfig.Webhooks {
+		roots := x509.NewCertPool()
+		require.True(roots.AppendCertsFromPEM(webhook.ClientConfig.CABundle))
+		for _, cert := range []*x509.Certificate{oldCert.Leaf, newCert.Leaf} {
+			_, err = cert.Verify(x509.VerifyOptions{DNSName: "gateway-admision-controller.gateway-system.svc", Roots: roots})
+			assert.NoError(err)
+		}
+	}
+
+	// The bundle is stable once patched
+	client.ClearActions()
+	require.NoError(b.Ensure(ctx))
+	for _, action := range client.Actions() {
+		assert.NotEqual("patch", action.GetVerb())
+	}
+}
+
+// once makes the first call of a verb on the secrets fail with err.
+func once(client *fake.Clientset, verb string, err error) {
+	done := false
+	client.PrependReactor(verb, "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if done {
+			return false, nil, nil
+		}
+		done = true
+		return true, nil, err
+	})
+}
+
+func TestBootstrapperReplicasStartingTogether(t *testing.T) {
+	notFound := apierrors.NewNotFound(corev1.Resource("secrets"), testSecretName)
+	conflict := apierrors.NewConflict(corev1.Resource("secrets"), testSecretName, nil)
+
+	tests := map[string]struct {
+		// expiring stores a certificate both replicas renew
+		expiring bool
+		// race makes the other replica's write win
+		race func(client *fake.Clientset)
+	}{
+		"Both create the secret": {
+			// The second replica did not see the secret created by the first one
+			race: func(client *fake.Clientset) { once(client, "get", notFound) },
+		},
+		"Both update the secret": {
+			expiring: true,
+			race:     func(client *fake.Clientset) { once(client, "update", conflict) },
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+			ctx := context.Background()
+
+			client := newTestClient()
+			if test.expiring {
+				require.NoError(newTestBootstrapper(t, client, 2*time.Hour, time.Hour).Ensure(ctx))
+			}
+			first := newTestBootstrapper(t, client, 24*time.Hour, 3*time.Hour)
+			require.NoError(first.Ensure(ctx))
+
+			second := newTestBootstrapper(t, client, 24*time.Hour, 3*time.Hour)
+			test.race(client)
+			require.NoError(second.Ensure(ctx))
+
+			firstCert, err := first.GetCertificate(nil)
+			require.NoError(err)
+			secondCert, err := second.GetCertificate(nil)
+			require.NoError(err)
+			assert.Equal(firstCert.Certificate, secondCert.Certificate)
+		})
+	}
+}
+
+func TestBootstrapperMissingWebhookConfig(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	b := newTestBootstrapper(t, client, 0, 0)
+
+	assert.Error(t, b.Ensure(context.Background()))
+	_, err := b.GetCertificate(nil)
+	assert.Error(t, err)
+}
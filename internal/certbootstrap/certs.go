@@ -0,0 +1,145 @@
+package certbootstrap
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// keyPair is a PEM encoded certificate and key.
+type keyPair struct {
+	certPEM []byte
+	keyPEM  []byte
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func encode(der []byte, key *ecdsa.PrivateKey) (keyPair, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return keyPair{}, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return keyPair{}, err
+	}
+	return keyPair{
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		cert:    cert,
+		key:     key,
+	}, nil
+}
+
+// newCA creates a self-signed CA.
+func newCA(commonName string, validity time.Duration) (keyPair, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return keyPair{}, fmt.Errorf("could not generate CA key: %w", err)
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return keyPair{}, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return keyPair{}, fmt.Errorf("could not create CA certificate: %w", err)
+	}
+	return encode(der, key)
+}
+
+// newServingCert creates a serving certificate for dnsNames signed by ca.
+func newServingCert(ca keyPair, dnsNames []string, validity time.Duration) (keyPair, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return keyPair{}, fmt.Errorf("could not generate serving key: %w", err)
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return keyPair{}, err
+	}
+
+	now := time.Now()
+	notAfter := now.Add(validity)
+	if notAfter.After(ca.cert.NotAfter) {
+		notAfter = ca.cert.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return keyPair{}, fmt.Errorf("could not create serving certificate: %w", err)
+	}
+	return encode(der, key)
+}
+
+// parseKeyPair parses a PEM certificate and EC key.
+func parseKeyPair(certPEM []byte, keyPEM []byte) (keyPair, error) {
+	if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		return keyPair{}, err
+	}
+	certBlock, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return keyPair{}, err
+	}
+	keyBlock, _ := pem.Decode(keyPEM)
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return keyPair{}, err
+	}
+	return keyPair{certPEM: certPEM, keyPEM: keyPEM, cert: cert, key: key}, nil
+}
+
+// caBundle returns the CA followed by the certificates of the current bundle that are
+// still valid, so the replicas still serving a certificate of a replaced CA are trusted
+// until it expires.
+func caBundle(caPEM []byte, current []byte, now time.Time) []byte {
+	bundle := append([]byte{}, caPEM...)
+	caBlock, _ := pem.Decode(caPEM)
+	for rest := current; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return bundle
+		}
+		if block.Type != "CERTIFICATE" || (caBlock != nil && bytes.Equal(block.Bytes, caBlock.Bytes)) {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil || !cert.IsCA || !cert.NotAfter.After(now) {
+			continue
+		}
+		bundle = append(bundle, pem.EncodeToMemory(block)...)
+	}
+}
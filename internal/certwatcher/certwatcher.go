@@ -0,0 +1,148 @@
+package certwatcher
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/angelnu/gateway-admision-controller/internal/log"
+	"github.com/angelnu/gateway-admision-controller/internal/metrics"
+)
+
+// Config is the certificate watcher configuration.
+type Config struct {
+	CertFile string
+	KeyFile  string
+	// Interval is how often the files are checked for changes.
+	Interval time.Duration
+	Logger   log.Logger
+	Metrics  metrics.Recorder
+}
+
+func (c *Config) defaults() error {
+
+	if c.CertFile == "" || c.KeyFile == "" {
+		return fmt.Errorf("cert and key files are required")
+	}
+
+	if c.Interval <= 0 {
+		c.Interval = 10 * time.Second
+	}
+
+	if c.Logger == nil {
+		c.Logger = log.Dummy
+	}
+
+	if c.Metrics == nil {
+		c.Metrics = metrics.Dummy
+	}
+
+	return nil
+}
+
+// Watcher serves a TLS certificate from files and reloads it when they change.
+type Watcher struct {
+	cfg    Config
+	logger log.Logger
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// New returns a new Watcher with the certificate already loaded.
+func New(config Config) (*Watcher, error) {
+	err := config.defaults()
+	if err != nil {
+		return nil, fmt.Errorf("certificate watcher configuration is not valid: %w", err)
+	}
+
+	w := &Watcher{
+		cfg:    config,
+		logger: config.Logger.WithKV(log.KV{"service": "certwatcher"}),
+	}
+	if _, err := w.Reload(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Reload loads the certificate if the files changed. It returns true when a new certificate is in use.
+// When the new files cannot be loaded the previous certificate is kept.
+func (w *Watcher) Reload() (bool, error) {
+	certPEM, err := os.ReadFile(w.cfg.CertFile)
+	if err != nil {
+		return false, fmt.Errorf("could not read certificate: %w", err)
+	}
+	keyPEM, err := os.ReadFile(w.cfg.KeyFile)
+	if err != nil {
+		return false, fmt.Errorf("could not read key: %w", err)
+	}
+
+	w.mu.RLock()
+	unchanged := bytes.Equal(certPEM, w.certPEM) && bytes.Equal(keyPEM, w.keyPEM)
+	w.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, fmt.Errorf("could not load certificate and key: %w", err)
+	}
+	if cert.Leaf == nil {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return false, fmt.Errorf("could not parse certificate: %w", err)
+		}
+	}
+
+	w.mu.Lock()
+	w.cert = &cert
+	w.certPEM = certPEM
+	w.keyPEM = keyPEM
+	w.mu.Unlock()
+
+	w.logger.Infof("loaded TLS certificate for %v, expires %s", cert.Leaf.DNSNames, cert.Leaf.NotAfter.Format(time.RFC3339))
+	w.cfg.Metrics.SetTLSCertificateExpiry(cert.Leaf.NotAfter)
+
+	return true, nil
+}
+
+// Run checks the files for changes until the context is done.
+func (w *Watcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if _, err := w.Reload(); err != nil {
+				w.logger.Errorf("keeping the previous TLS certificate: %s", err)
+			}
+		}
+	}
+}
+
+// GetCertificate returns the current certificate, to be used in tls.Config.
+func (w *Watcher) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.cert, nil
+}
+
+// NotAfter returns the expiry of the current certificate.
+func (w *Watcher) NotAfter() time.Time {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.cert.Leaf.NotAfter
+}
@@ -0,0 +1,93 @@
+package certwatcher_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/angelnu/gateway-admision-controller/internal/certwatcher"
+)
+
+func writeCert(t *testing.T, certFile string, keyFile string, notAfter time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gateway-admision-controller"},
+		DNSNames:     []string{"gateway-admision-controller.default.svc"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+}
+
+func TestWatcherReload(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+
+	firstExpiry := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	writeCert(t, certFile, keyFile, firstExpiry)
+
+	w, err := certwatcher.New(certwatcher.Config{CertFile: certFile, KeyFile: keyFile})
+	require.NoError(err)
+	first, err := w.GetCertificate(nil)
+	require.NoError(err)
+	assert.True(firstExpiry.Equal(w.NotAfter()))
+
+	// Unchanged files are not reloaded
+	reloaded, err := w.Reload()
+	require.NoError(err)
+	assert.False(reloaded)
+
+	// Rotated certificate is served
+	secondExpiry := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	writeCert(t, certFile, keyFile, secondExpiry)
+	reloaded, err = w.Reload()
+	require.NoError(err)
+	assert.True(reloaded)
+	second, err := w.GetCertificate(nil)
+	require.NoError(err)
+	assert.NotSame(first, second)
+	assert.True(secondExpiry.Equal(w.NotAfter()))
+
+	// A broken pair keeps the previous certificate
+	require.NoError(os.WriteFile(keyFile, []byte("not a key"), 0600))
+	reloaded, err = w.Reload()
+	assert.Error(err)
+	assert.False(reloaded)
+	current, err := w.GetCertificate(nil)
+	require.NoError(err)
+	assert.Same(second, current)
+}
+
+func TestNewWatcherReturnsError(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := certwatcher.New(certwatcher.Config{
+		CertFile: filepath.Join(dir, "missing.crt"),
+		KeyFile:  filepath.Join(dir, "missing.key"),
+	})
+	assert.Error(t, err)
+}
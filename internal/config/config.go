@@ -1,24 +1,61 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
 	"os"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 )
 
 // CmdConfig represents the configuration of the command.
 type CmdConfig struct {
+	Command                   string
 	Debug                     bool
 	Development               bool
+	LogBackend                string
+	LogLevel                  string
+	LogFormat                 string
+	AdminTokenFile            string
+	AdminListenAddr           string
 	SetGatewayDefault         bool
 	WebhookListenAddr         string
+	WebhookReadTimeout        time.Duration
+	WebhookWriteTimeout       time.Duration
+	WebhookIdleTimeout        time.Duration
+	WebhookMaxInFlight        int
+	WebhookAdmissionTimeout   time.Duration
 	MetricsListenAddr         string
 	MetricsPath               string
+	ProbeListenAddr           string
+	ShutdownDelay             time.Duration
+	ShutdownDrainTimeout      time.Duration
+	TracingExporter           string
+	TracingOTLPEndpoint       string
+	TracingOTLPInsecure       bool
+	TracingSampleRatio        float64
 	TLSCertFilePath           string
 	TLSKeyFilePath            string
+	TLSReloadInterval         time.Duration
+	TLSBootstrap              TLSBootstrapConfig
+	TLSClientCAFile           string
+	TLSClientAllowedNames     string
 	Gateway                   string
 	DNS                       string
 	DNSPolicy                 string
+	ResolvConfPath            string
+	ClusterDomain             string
+	DNSSearch                 string
+	DNSOptions                string
+	DNSMergeNameservers       string
+	DNSMergeSearches          string
+	DNSMergeOptions           string
+	AllowedDNSOverrides       string
+	BypassCIDRs               string
 	SetGatewayLabel           string
 	SetGatewayLabelValue      string
 	SetGatewayAnnotation      string
@@ -27,58 +64,294 @@ type CmdConfig struct {
 	InitImagePullPol          string
 	InitCmd                   string
 	InitMountPoint            string
+	InitContainerPosition     string
 	SidecarImage              string
 	SidecarImagePullPol       string
 	SidecarCmd                string
 	SidecarMountPoint         string
 	SidecarAsInit             bool
+	SidecarMode               string
+	PortForwardRange          string
+	KillSwitch                bool
+	KillSwitchAllowedCIDRs    string
+	KillSwitchRequiredNs      string
+	ServerVersionRefresh      time.Duration
+	FailurePolicyDNS          string
+	FailurePolicyAnnotation   string
+	FailurePolicyNameConflict string
 	ConfigmapName             string
+	Env                       map[string]string
+	// Deprecations are warnings about the deprecated flags used.
+	Deprecations []string
 }
 
+// TLSBootstrapConfig is the configuration of the self-signed certificate bootstrap.
+type TLSBootstrapConfig struct {
+	Enabled           bool
+	Namespace         string
+	ServiceName       string
+	SecretName        string
+	WebhookConfigName string
+	CertValidity      time.Duration
+	RotateBefore      time.Duration
+	CheckInterval     time.Duration
+}
+
+const (
+	// SidecarModeContainer injects the sidecar as a regular container.
+	SidecarModeContainer = "container"
+	// SidecarModeInit injects the sidecar as a native sidecar (init container with RestartPolicy Always).
+	SidecarModeInit = "init"
+	// SidecarModeAuto uses native sidecars when the API server supports them.
+	SidecarModeAuto = "auto"
+)
+
+const (
+	// LogBackendLogrus logs with logrus.
+	LogBackendLogrus = "logrus"
+	// LogBackendSlog logs with the standard library log/slog.
+	LogBackendSlog = "slog"
+)
+
+const (
+	// LogFormatText is the logrus text format, colored on terminals, or the slog text format.
+	LogFormatText = "text"
+	// LogFormatJSON is one JSON object per line.
+	LogFormatJSON = "json"
+	// LogFormatLogfmt is key=value pairs without colors.
+	LogFormatLogfmt = "logfmt"
+)
+
+const (
+	// DNSMergeReplace replaces the pod DNS config entries with the gateway ones.
+	DNSMergeReplace = "replace"
+	// DNSMergeAppend appends the gateway entries to the pod ones.
+	DNSMergeAppend = "merge-append"
+	// DNSMergePrepend puts the gateway entries before the pod ones.
+	DNSMergePrepend = "merge-prepend"
+	// DNSMergeKeepPod keeps the pod entries, the gateway ones are only used when the pod has none.
+	DNSMergeKeepPod = "keep-pod"
+)
+
+const (
+	// FailurePolicyDeny rejects the pod.
+	FailurePolicyDeny = "deny"
+	// FailurePolicyAllow admits the pod unmutated with a warning.
+	FailurePolicyAllow = "allow"
+	// FailurePolicyLastKnownGood injects the gateway with the last resolved addresses.
+	FailurePolicyLastKnownGood = "last-known-good"
+)
+
+const (
+	// CommandServe runs the webhook.
+	CommandServe = "serve"
+	// CommandValidateConfig validates the configuration and exits.
+	CommandValidateConfig = "validate-config"
+)
+
+// renamedFlags are the camelCase flag names replaced by kebab-case ones. They still
+// work as hidden aliases.
+var renamedFlags = []struct {
+	deprecated string
+	name       string
+}{
+	{"DNS", "dns"},
+	{"DNSPolicy", "dns-policy"},
+	{"resolvConf", "resolv-conf"},
+	{"clusterDomain", "cluster-domain"},
+	{"DNSSearch", "dns-search"},
+	{"DNSMergeNameservers", "dns-merge-nameservers"},
+	{"DNSMergeSearches", "dns-merge-searches"},
+	{"DNSMergeOptions", "dns-merge-options"},
+	{"allowedDNSOverrides", "allowed-dns-overrides"},
+	{"DNSOptions", "dns-options"},
+	{"bypassCIDRs", "bypass-cidrs"},
+	{"setGatewayDefault", "set-gateway-default"},
+	{"setGatewayLabel", "set-gateway-label"},
+	{"setGatewayLabelValue", "set-gateway-label-value"},
+	{"setGatewayAnnotation", "set-gateway-annotation"},
+	{"setGatewayAnnotationValue", "set-gateway-annotation-value"},
+	{"initImage", "init-image"},
+	{"initImagePullPol", "init-image-pull-policy"},
+	{"initCmd", "init-cmd"},
+	{"initMountPoint", "init-mount-point"},
+	{"initContainerPosition", "init-container-position"},
+	{"sidecarImage", "sidecar-image"},
+	{"sidecarImagePullPol", "sidecar-image-pull-policy"},
+	{"sidecarCmd", "sidecar-cmd"},
+	{"sidecarMountPoint", "sidecar-mount-point"},
+	{"sidecarAsInit", "sidecar-as-init"},
+	{"sidecarMode", "sidecar-mode"},
+	{"portForwardRange", "port-forward-range"},
+	{"killSwitch", "kill-switch"},
+	{"killSwitchAllowedCIDRs", "kill-switch-allowed-cidrs"},
+	{"killSwitchRequiredNamespaces", "kill-switch-required-namespaces"},
+	{"failurePolicyDNS", "failure-policy-dns"},
+	{"failurePolicyInvalidAnnotation", "failure-policy-invalid-annotation"},
+	{"failurePolicyNameConflict", "failure-policy-name-conflict"},
+	{"serverVersionRefresh", "server-version-refresh"},
+	{"configmapName", "configmap-name"},
+}
+
+// redacted replaces the secret values.
+const redacted = "REDACTED"
+
 var (
 	// Version is set at compile time.
 	Version = "dev"
 )
 
-// NewCmdConfig returns a new command configuration.
+// NewCmdConfig returns a new command configuration. Check it with gatewayPodMutator.Validate,
+// which also parses the mutator settings.
 func NewCmdConfig() (*CmdConfig, error) {
-	c := &CmdConfig{}
+	// kingpin adds the map entries to the given map
+	c := &CmdConfig{Env: map[string]string{}}
 	app := kingpin.New("gateway-admision-controller", "Kubenetes admision controller webhook to change the POD default gateway and DNS")
 	app.Version(Version)
+	// Every flag may be set with the GATEWAY_ADMISION_CONTROLLER_<FLAG> env, e.g. GATEWAY_ADMISION_CONTROLLER_SET_GATEWAY_LABEL.
+	app.DefaultEnvars()
+	app.Command(CommandServe, "Run the webhook.").Default()
+	app.Command(CommandValidateConfig, "Validate the configuration and exit, non-zero when it has errors.")
 
 	app.Flag("debug", "Enable debug mode.").BoolVar(&c.Debug)
 	app.Flag("development", "Enable development mode.").BoolVar(&c.Development)
+	app.Flag("log-backend", "Logging library: logrus or slog.").Default(LogBackendLogrus).EnumVar(&c.LogBackend, LogBackendLogrus, LogBackendSlog)
+	app.Flag("log-level", "Log level (error, warning, info, debug or trace) followed by comma separated <component>=<level> overrides for the webhook, mutator and resolver components, e.g. info,mutator=trace. --debug raises the default level to debug. SIGUSR1 toggles the default level between debug and this one, or info when this one is debug.").Default("info").StringVar(&c.LogLevel)
+	app.Flag("log-format", "Log format: text, json or logfmt. Defaults to text in development mode and json otherwise.").EnumVar(&c.LogFormat, LogFormatText, LogFormatJSON, LogFormatLogfmt)
+	app.Flag("admin-token-file", "File with the bearer token of the admin endpoints, served under /admin/ on the admin-listen-address, or on the metrics server when it is empty. They are disabled when empty.").StringVar(&c.AdminTokenFile)
+	app.Flag("admin-listen-address", "The address where an HTTPS server with the webhook certificate serves the admin endpoints. When empty they are served on the plain HTTP metrics server, where the bearer token is sent in cleartext: only do that when the metrics port is not reachable from untrusted networks.").StringVar(&c.AdminListenAddr)
 	app.Flag("webhook-listen-address", "The address where the HTTPS server will be listening to serve the webhooks.").Default(":8080").StringVar(&c.WebhookListenAddr)
+	app.Flag("webhook-read-timeout", "Maximum duration for reading a webhook request, including the body.").Default("10s").DurationVar(&c.WebhookReadTimeout)
+	app.Flag("webhook-write-timeout", "Maximum duration before timing out writes of a webhook response.").Default("30s").DurationVar(&c.WebhookWriteTimeout)
+	app.Flag("webhook-idle-timeout", "Maximum time to wait for the next request on a keep-alive webhook connection.").Default("120s").DurationVar(&c.WebhookIdleTimeout)
+	app.Flag("webhook-max-inflight", "Maximum admission requests processed at the same time, more are rejected with 429. Unlimited when 0.").Default("0").IntVar(&c.WebhookMaxInFlight)
+	app.Flag("webhook-admission-timeout", "Maximum duration of an admission, gateway and DNS lookups are cancelled when it expires. Unbounded when 0.").Default("10s").DurationVar(&c.WebhookAdmissionTimeout)
 	app.Flag("tls-cert-file-path", "The path for the webhook HTTPS server TLS cert file.").StringVar(&c.TLSCertFilePath)
 	app.Flag("tls-key-file-path", "The path for the webhook HTTPS server TLS key file.").StringVar(&c.TLSKeyFilePath)
+	app.Flag("tls-reload-interval", "How often the TLS cert and key files are checked for changes.").Default("10s").DurationVar(&c.TLSReloadInterval)
+	app.Flag("tls-client-ca-file", "Require webhook clients to present a certificate signed by a CA of this PEM bundle. The health endpoints don't require it.").StringVar(&c.TLSClientCAFile)
+	app.Flag("tls-client-allowed-names", "Comma separated subject common names or DNS names allowed for client certificates. Any name is allowed when empty.").StringVar(&c.TLSClientAllowedNames)
+	app.Flag("tls-bootstrap", "Generate a self-signed certificate, store it in a secret and patch the caBundle of the webhook configuration.").BoolVar(&c.TLSBootstrap.Enabled)
+	app.Flag("tls-bootstrap-namespace", "Namespace of the webhook service and the certificate secret. Defaults to the pod namespace.").StringVar(&c.TLSBootstrap.Namespace)
+	app.Flag("tls-bootstrap-service-name", "Name of the webhook service the certificate is generated for.").StringVar(&c.TLSBootstrap.ServiceName)
+	app.Flag("tls-bootstrap-secret-name", "Name of the secret where the certificate is stored.").StringVar(&c.TLSBootstrap.SecretName)
+	app.Flag("tls-bootstrap-webhook-config-name", "Name of the MutatingWebhookConfiguration to patch with the CA.").StringVar(&c.TLSBootstrap.WebhookConfigName)
+	app.Flag("tls-bootstrap-cert-validity", "Validity of the generated serving certificate.").Default("8760h").DurationVar(&c.TLSBootstrap.CertValidity)
+	app.Flag("tls-bootstrap-rotate-before", "How long before expiry the serving certificate is renewed.").Default("720h").DurationVar(&c.TLSBootstrap.RotateBefore)
+	app.Flag("tls-bootstrap-check-interval", "How often the certificate secret and the caBundle are checked.").Default("1h").DurationVar(&c.TLSBootstrap.CheckInterval)
+	app.Flag("metrics-listen-address", "The address where the metrics HTTP server will be listening.").Default(":8081").StringVar(&c.MetricsListenAddr)
+	app.Flag("metrics-path", "The path for the metrics endpoint.").Default("/metrics").StringVar(&c.MetricsPath)
+	app.Flag("shutdown-delay", "How long to keep serving with readiness failing after a termination signal, so the API server stops sending requests before draining.").Default("0s").DurationVar(&c.ShutdownDelay)
+	app.Flag("shutdown-drain-timeout", "Maximum time to wait for in-flight requests when shutting down, they are aborted afterwards.").Default("5s").DurationVar(&c.ShutdownDrainTimeout)
+	app.Flag("tracing-exporter", "Where to export the OpenTelemetry traces of the admissions: none, stdout or otlp.").Default("none").EnumVar(&c.TracingExporter, "none", "stdout", "otlp")
+	app.Flag("tracing-otlp-endpoint", "The host:port of the OTLP/HTTP collector. The OTEL_EXPORTER_OTLP_* env are used when empty.").StringVar(&c.TracingOTLPEndpoint)
+	app.Flag("tracing-otlp-insecure", "Send the traces to the OTLP collector without TLS.").BoolVar(&c.TracingOTLPInsecure)
+	app.Flag("tracing-sample-ratio", "Ratio of the admissions traced when the API server does not send a trace context.").Default("1").Float64Var(&c.TracingSampleRatio)
+	app.Flag("probe-listen-address", "The address where a plain HTTP server serves /livez and /readyz. They are served by the webhook server when empty.").StringVar(&c.ProbeListenAddr)
 
 	app.Flag("gateway", "Name/IP of the gateway pod").StringVar(&c.Gateway)
-	app.Flag("DNS", "Name/IP of the DNS (might be the same as the gateway pod)").StringVar(&c.DNS)
-	app.Flag("DNSPolicy", "Set DNSPolicy").StringVar(&c.DNSPolicy)
+	app.Flag("dns", "Name/IP of the DNS (might be the same as the gateway pod)").StringVar(&c.DNS)
+	app.Flag("dns-policy", "Set DNSPolicy").StringVar(&c.DNSPolicy)
+	app.Flag("resolv-conf", "resolv.conf with the cluster nameservers, search list and options copied to the pods with DNSPolicy None").Default("/etc/resolv.conf").StringVar(&c.ResolvConfPath)
+	app.Flag("cluster-domain", "Cluster domain used to build the <namespace>.svc.<domain>, svc.<domain> and <domain> searches with DNSPolicy None, instead of the resolv-conf search list, and the <service>.<namespace>.svc.<domain> name of the tls-bootstrap certificate (cluster.local when empty)").StringVar(&c.ClusterDomain)
+	app.Flag("dns-search", "Comma separated search domains used with DNSPolicy None instead of the resolv-conf search list, after the cluster-domain ones").StringVar(&c.DNSSearch)
+	app.Flag("dns-merge-nameservers", "How to merge the gateway nameservers with the ones set by the pod dnsConfig: replace, merge-append, merge-prepend or keep-pod").Default(DNSMergeReplace).EnumVar(&c.DNSMergeNameservers, DNSMergeReplace, DNSMergeAppend, DNSMergePrepend, DNSMergeKeepPod)
+	app.Flag("dns-merge-searches", "How to merge the gateway search domains with the ones set by the pod dnsConfig: replace, merge-append, merge-prepend or keep-pod").Default(DNSMergeReplace).EnumVar(&c.DNSMergeSearches, DNSMergeReplace, DNSMergeAppend, DNSMergePrepend, DNSMergeKeepPod)
+	app.Flag("dns-merge-options", "How to merge the gateway resolver options with the ones set by the pod dnsConfig: replace, merge-append, merge-prepend or keep-pod. The first option with a name wins").Default(DNSMergeReplace).EnumVar(&c.DNSMergeOptions, DNSMergeReplace, DNSMergeAppend, DNSMergePrepend, DNSMergeKeepPod)
+	app.Flag("allowed-dns-overrides", "Comma separated DNS settings pods may override with the gateway.angelnu.github.io/<override> annotations: dns (server list, empty to keep the pod DNS), dns-policy and dns-options. Pods with other overrides are handled by failure-policy-invalid-annotation").StringVar(&c.AllowedDNSOverrides)
+	app.Flag("dns-options", "Comma separated name[:value] resolver options used with DNSPolicy None instead of the resolv-conf options, e.g. ndots:5,edns0").StringVar(&c.DNSOptions)
+	app.Flag("bypass-cidrs", "Comma separated CIDRs that must not go through the gateway (pod, service and node networks). Pods may add more with the gateway.angelnu.github.io/bypass-cidrs annotation").StringVar(&c.BypassCIDRs)
+
+	app.Flag("set-gateway-default", "Set gateway by default in absence of label/annotation").BoolVar(&c.SetGatewayDefault)
+	app.Flag("set-gateway-label", "Set gateway for pods with this label set to 'true'").StringVar(&c.SetGatewayLabel)
+	app.Flag("set-gateway-label-value", "Set gateway for pods with label set to this value").StringVar(&c.SetGatewayLabelValue)
+	app.Flag("set-gateway-annotation", "Set gateway for pods with this annotation set to 'true'").StringVar(&c.SetGatewayAnnotation)
+	app.Flag("set-gateway-annotation-value", "Set gateway for pods with annotation set to this value").StringVar(&c.SetGatewayAnnotationValue)
 
-	app.Flag("setGatewayDefault", "Set gateway by default in absence of label/annotation").BoolVar(&c.SetGatewayDefault)
-	app.Flag("setGatewayLabel", "Set gateway for pods with this label set to 'true'").StringVar(&c.SetGatewayLabel)
-	app.Flag("setGatewayLabelValue", "Set gateway for pods with label set to this value").StringVar(&c.SetGatewayLabelValue)
-	app.Flag("setGatewayAnnotation", "Set gateway for pods with this annotation set to 'true'").StringVar(&c.SetGatewayAnnotation)
-	app.Flag("setGatewayAnnotationValue", "Set gateway for pods with annotation set to this value").StringVar(&c.SetGatewayAnnotationValue)
+	app.Flag("init-image", "Init container image").StringVar(&c.InitImage)
+	app.Flag("init-image-pull-policy", "Init container pull policy").StringVar(&c.InitImagePullPol)
+	app.Flag("init-cmd", "Init command to execute instead of container default").StringVar(&c.InitCmd)
+	app.Flag("init-mount-point", "Mountpoint for configmap in init container").StringVar(&c.InitMountPoint)
+	app.Flag("init-container-position", "Where to insert the gateway init containers: first, last, before:<container> or after:<container>").Default("last").StringVar(&c.InitContainerPosition)
 
-	app.Flag("initImage", "Init container image").StringVar(&c.InitImage)
-	app.Flag("initImagePullPol", "Init container pull policy").StringVar(&c.InitImagePullPol)
-	app.Flag("initCmd", "Init command to execute instead of container default").StringVar(&c.InitCmd)
-	app.Flag("initMountPoint", "Mountpoint for configmap in init container").StringVar(&c.InitMountPoint)
+	app.Flag("sidecar-image", "Sidecar container image").StringVar(&c.SidecarImage)
+	app.Flag("sidecar-image-pull-policy", "Sidecar container pull policy").StringVar(&c.SidecarImagePullPol)
+	app.Flag("sidecar-cmd", "Sidecard command to execute instead of container default").StringVar(&c.SidecarCmd)
+	app.Flag("sidecar-mount-point", "Mountpoint for configmap in sidecar container").StringVar(&c.SidecarMountPoint)
+	app.Flag("sidecar-as-init", "Create the sidecar as an init container. Requires Kubernetes v1.29").BoolVar(&c.SidecarAsInit)
+	app.Flag("sidecar-mode", "How to create the sidecar: container, init or auto (init when the API server supports native sidecars). Overrides sidecar-as-init").EnumVar(&c.SidecarMode, SidecarModeContainer, SidecarModeInit, SidecarModeAuto)
+	app.Flag("port-forward-range", "Ports pods may forward through the gateway with the gateway.angelnu.github.io/port-forward annotation, as <min>-<max>. Port forwarding is disabled when empty").StringVar(&c.PortForwardRange)
+	app.Flag("kill-switch", "Block pod traffic outside the gateway when the tunnel is down. Pods may override it with the gateway.angelnu.github.io/kill-switch annotation").BoolVar(&c.KillSwitch)
+	app.Flag("kill-switch-allowed-cidrs", "Comma separated CIDRs still reachable when the kill switch is active, in addition to bypass-cidrs").StringVar(&c.KillSwitchAllowedCIDRs)
+	app.Flag("kill-switch-required-namespaces", "Comma separated namespaces where pods cannot disable the kill switch").StringVar(&c.KillSwitchRequiredNs)
+	app.Flag("failure-policy-dns", "What to do with a pod when the DNS cannot be resolved: deny, allow (unmutated) or last-known-good. With deny the gateway and DNS lookups are also readiness checks").Default(FailurePolicyDeny).EnumVar(&c.FailurePolicyDNS, FailurePolicyDeny, FailurePolicyAllow, FailurePolicyLastKnownGood)
+	app.Flag("failure-policy-invalid-annotation", "What to do with a pod with an invalid gateway label or annotation: deny or allow (unmutated)").Default(FailurePolicyDeny).EnumVar(&c.FailurePolicyAnnotation, FailurePolicyDeny, FailurePolicyAllow)
+	app.Flag("failure-policy-name-conflict", "What to do with a pod that already has a container or volume with the name of an injected one: deny or allow (unmutated)").Default(FailurePolicyDeny).EnumVar(&c.FailurePolicyNameConflict, FailurePolicyDeny, FailurePolicyAllow)
+	app.Flag("server-version-refresh", "How often to refresh the API server version in sidecar-mode auto").Default("10m").DurationVar(&c.ServerVersionRefresh)
 
-	app.Flag("sidecarImage", "Sidecar container image").StringVar(&c.SidecarImage)
-	app.Flag("sidecarImagePullPol", "Sidecar container pull policy").StringVar(&c.SidecarImagePullPol)
-	app.Flag("sidecarCmd", "Sidecard command to execute instead of container default").StringVar(&c.SidecarCmd)
-	app.Flag("sidecarMountPoint", "Mountpoint for configmap in sidecar container").StringVar(&c.SidecarMountPoint)
-	app.Flag("sidecarAsInit", "Create the sidecar as an init container. Requires Kubernetes v1.29").BoolVar(&c.SidecarAsInit)
+	app.Flag("configmap-name", "Name of the configmap to attach to containers").StringVar(&c.ConfigmapName)
+	app.Flag("env", "Extra NAME=VALUE env for the gateway containers. VALUE (and the mount points) may be a Go template using the pod metadata").StringMapVar(&c.Env)
 
-	app.Flag("configmapName", "Name of the configmap to attach to containers").StringVar(&c.ConfigmapName)
+	for _, renamed := range renamedFlags {
+		renamed := renamed
+		app.Flag(renamed.deprecated, "Deprecated, use --"+renamed.name).Hidden().NoEnvar().
+			Action(func(*kingpin.ParseContext) error {
+				c.Deprecations = append(c.Deprecations, fmt.Sprintf("--%s is deprecated, use --%s", renamed.deprecated, renamed.name))
+				return nil
+			}).
+			SetValue(app.GetFlag(renamed.name).Model().Value)
+	}
 
-	_, err := app.Parse(os.Args[1:])
+	command, err := app.Parse(os.Args[1:])
 	if err != nil {
 		return nil, err
 	}
+	c.Command = command
 
 	return c, nil
 }
+
+// SidecarModeOrDefault returns the sidecar mode, defaulting to the one implied by SidecarAsInit.
+func (c CmdConfig) SidecarModeOrDefault() string {
+	if c.SidecarMode != "" {
+		return c.SidecarMode
+	}
+	if c.SidecarAsInit {
+		return SidecarModeInit
+	}
+	return SidecarModeContainer
+}
+
+// Redacted returns a copy of the configuration that is safe to log or show: the env
+// values, which may hold credentials, and the password of the OTLP endpoint are hidden.
+func (c CmdConfig) Redacted() CmdConfig {
+	if c.Env != nil {
+		env := make(map[string]string, len(c.Env))
+		for name := range c.Env {
+			env[name] = redacted
+		}
+		c.Env = env
+	}
+	if u, err := url.Parse(c.TracingOTLPEndpoint); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+			c.TracingOTLPEndpoint = u.String()
+		}
+	}
+	return c
+}
+
+// Hash identifies the configuration so replicas can be compared: it is the SHA-256 of the
+// redacted options, so it cannot be used to guess the secrets, and ignores the deprecation
+// warnings.
+func (c CmdConfig) Hash() string {
+	c = c.Redacted()
+	c.Deprecations = nil
+	data, err := json.Marshal(c)
+	if err != nil {
+		// Only plain types, it cannot fail
+		panic(err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
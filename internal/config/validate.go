@@ -0,0 +1,223 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/angelnu/gateway-admision-controller/internal/log"
+)
+
+// ValidationError lists all the problems found in a configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// imageReference is the image reference grammar of the distribution project:
+// [domain[:port]/]path[:tag][@digest]
+var imageReference = func() *regexp.Regexp {
+	domainComponent := `(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])`
+	domain := domainComponent + `(?:\.` + domainComponent + `)*(?::[0-9]+)?`
+	pathComponent := `[a-z0-9]+(?:(?:[._]|__|[-]+)[a-z0-9]+)*`
+	name := `(?:` + domain + `/)?` + pathComponent + `(?:/` + pathComponent + `)*`
+	tag := `[\w][\w.-]{0,127}`
+	digest := `[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,}`
+	return regexp.MustCompile(`^` + name + `(?::` + tag + `)?(?:@` + digest + `)?$`)
+}()
+
+var (
+	dnsPolicies = []string{
+		string(corev1.DNSClusterFirst),
+		string(corev1.DNSClusterFirstWithHostNet),
+		string(corev1.DNSDefault),
+		string(corev1.DNSNone),
+	}
+	pullPolicies = []string{
+		string(corev1.PullAlways),
+		string(corev1.PullIfNotPresent),
+		string(corev1.PullNever),
+	}
+	dnsMergeStrategies = []string{DNSMergeReplace, DNSMergeAppend, DNSMergePrepend, DNSMergeKeepPod}
+)
+
+// validator collects the problems of a configuration.
+type validator struct {
+	problems []string
+}
+
+func (v *validator) problem(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+// oneOf checks an optional enum.
+func (v *validator) oneOf(option string, value string, values ...string) {
+	if value == "" {
+		return
+	}
+	for _, allowed := range values {
+		if value == allowed {
+			return
+		}
+	}
+	v.problem("%s %q must be one of %s", option, value, strings.Join(values, ", "))
+}
+
+// requires checks that an option is only set with the one it depends on.
+func (v *validator) requires(option string, set bool, dependency string, dependencySet bool) {
+	if set && !dependencySet {
+		v.problem("%s requires %s", option, dependency)
+	}
+}
+
+func (v *validator) image(option string, value string) {
+	if value != "" && !imageReference.MatchString(value) {
+		v.problem("%s %q is not a valid image reference", option, value)
+	}
+}
+
+// mountPoint checks the path is absolute. Mount points are templates, only the start is checked.
+func (v *validator) mountPoint(option string, value string) {
+	if value != "" && !strings.HasPrefix(value, "/") {
+		v.problem("%s %q must be an absolute path", option, value)
+	}
+}
+
+// positive checks a duration that must be set.
+func (v *validator) positive(option string, value time.Duration) {
+	if value <= 0 {
+		v.problem("%s %s must be positive", option, value)
+	}
+}
+
+// notNegative checks a duration where 0 disables or leaves unbounded what it sets.
+func (v *validator) notNegative(option string, value time.Duration) {
+	if value < 0 {
+		v.problem("%s %s must not be negative", option, value)
+	}
+}
+
+// hosts checks a comma separated list of IPs or DNS names.
+func (v *validator) hosts(option string, value string) {
+	if value == "" {
+		return
+	}
+	for _, host := range strings.Split(value, ",") {
+		if net.ParseIP(host) != nil {
+			continue
+		}
+		// Absolute names end with a dot
+		if errs := validation.IsDNS1123Subdomain(strings.TrimSuffix(host, ".")); len(errs) > 0 {
+			v.problem("%s %q is not an IP or DNS name", option, host)
+		}
+	}
+}
+
+// allowsOverride tells if the comma separated allowed overrides contain override.
+func allowsOverride(allowed string, override string) bool {
+	for _, entry := range strings.Split(allowed, ",") {
+		if strings.TrimSpace(entry) == override {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the configuration without contacting the cluster and returns a
+// ValidationError with all the problems found.
+func (c CmdConfig) Validate() error {
+	v := &validator{}
+
+	// Enums, the flags check them too but not the configurations built otherwise
+	v.oneOf("dns-policy", c.DNSPolicy, dnsPolicies...)
+	v.oneOf("init-image-pull-policy", c.InitImagePullPol, pullPolicies...)
+	v.oneOf("sidecar-image-pull-policy", c.SidecarImagePullPol, pullPolicies...)
+	v.oneOf("sidecar-mode", c.SidecarMode, SidecarModeContainer, SidecarModeInit, SidecarModeAuto)
+	v.oneOf("failure-policy-dns", c.FailurePolicyDNS, FailurePolicyDeny, FailurePolicyAllow, FailurePolicyLastKnownGood)
+	v.oneOf("failure-policy-invalid-annotation", c.FailurePolicyAnnotation, FailurePolicyDeny, FailurePolicyAllow)
+	v.oneOf("failure-policy-name-conflict", c.FailurePolicyNameConflict, FailurePolicyDeny, FailurePolicyAllow)
+	v.oneOf("dns-merge-nameservers", c.DNSMergeNameservers, dnsMergeStrategies...)
+	v.oneOf("dns-merge-searches", c.DNSMergeSearches, dnsMergeStrategies...)
+	v.oneOf("dns-merge-options", c.DNSMergeOptions, dnsMergeStrategies...)
+	v.oneOf("log-backend", c.LogBackend, LogBackendLogrus, LogBackendSlog)
+	v.oneOf("log-format", c.LogFormat, LogFormatText, LogFormatJSON, LogFormatLogfmt)
+	v.oneOf("tracing-exporter", c.TracingExporter, "none", "stdout", "otlp")
+	if c.LogLevel != "" {
+		if _, err := log.ParseLevels(c.LogLevel); err != nil {
+			v.problem("log-level: %s", err)
+		}
+	}
+	if c.TracingSampleRatio < 0 || c.TracingSampleRatio > 1 {
+		v.problem("tracing-sample-ratio %v must be between 0 and 1", c.TracingSampleRatio)
+	}
+
+	// Options that only work together
+	v.requires("set-gateway-label-value", c.SetGatewayLabelValue != "", "set-gateway-label", c.SetGatewayLabel != "")
+	v.requires("set-gateway-annotation-value", c.SetGatewayAnnotationValue != "", "set-gateway-annotation", c.SetGatewayAnnotation != "")
+	v.requires("init-cmd", c.InitCmd != "", "init-image", c.InitImage != "")
+	v.requires("init-image-pull-policy", c.InitImagePullPol != "", "init-image", c.InitImage != "")
+	v.requires("init-mount-point", c.InitMountPoint != "", "configmap-name", c.ConfigmapName != "")
+	v.requires("sidecar-cmd", c.SidecarCmd != "", "sidecar-image", c.SidecarImage != "")
+	v.requires("sidecar-image-pull-policy", c.SidecarImagePullPol != "", "sidecar-image", c.SidecarImage != "")
+	v.requires("sidecar-mount-point", c.SidecarMountPoint != "", "configmap-name", c.ConfigmapName != "")
+	v.requires("dns-policy None", c.DNSPolicy == string(corev1.DNSNone), "dns", c.DNS != "")
+	// Pods may also switch to None with the dns-policy annotation when it is allowed
+	dnsPolicyNone := c.DNSPolicy == string(corev1.DNSNone) || allowsOverride(c.AllowedDNSOverrides, "dns-policy")
+	v.requires("cluster-domain", c.ClusterDomain != "", "dns-policy None or tls-bootstrap", dnsPolicyNone || c.TLSBootstrap.Enabled)
+	v.requires("dns-search", c.DNSSearch != "", "dns-policy None", dnsPolicyNone)
+	v.requires("dns-options", c.DNSOptions != "", "dns-policy None", dnsPolicyNone)
+	v.requires("tls-cert-file-path", c.TLSCertFilePath != "", "tls-key-file-path", c.TLSKeyFilePath != "")
+	v.requires("tls-key-file-path", c.TLSKeyFilePath != "", "tls-cert-file-path", c.TLSCertFilePath != "")
+	v.requires("admin-listen-address", c.AdminListenAddr != "", "admin-token-file", c.AdminTokenFile != "")
+	v.requires("admin-listen-address", c.AdminListenAddr != "", "TLS", c.TLSCertFilePath != "" || c.TLSBootstrap.Enabled)
+	v.requires("tls-client-ca-file", c.TLSClientCAFile != "", "TLS", c.TLSCertFilePath != "" || c.TLSBootstrap.Enabled)
+	v.requires("tls-bootstrap", c.TLSBootstrap.Enabled, "tls-bootstrap-service-name", c.TLSBootstrap.ServiceName != "")
+	v.requires("tls-bootstrap", c.TLSBootstrap.Enabled, "tls-bootstrap-secret-name", c.TLSBootstrap.SecretName != "")
+	v.requires("tls-bootstrap", c.TLSBootstrap.Enabled, "tls-bootstrap-webhook-config-name", c.TLSBootstrap.WebhookConfigName != "")
+
+	// Limits and durations, the ones of disabled features are ignored
+	if c.WebhookMaxInFlight < 0 {
+		v.problem("webhook-max-inflight %d must not be negative", c.WebhookMaxInFlight)
+	}
+	v.notNegative("webhook-read-timeout", c.WebhookReadTimeout)
+	v.notNegative("webhook-write-timeout", c.WebhookWriteTimeout)
+	v.notNegative("webhook-idle-timeout", c.WebhookIdleTimeout)
+	v.notNegative("webhook-admission-timeout", c.WebhookAdmissionTimeout)
+	v.notNegative("shutdown-delay", c.ShutdownDelay)
+	v.notNegative("shutdown-drain-timeout", c.ShutdownDrainTimeout)
+	if c.TLSCertFilePath != "" {
+		v.positive("tls-reload-interval", c.TLSReloadInterval)
+	}
+	if c.TLSBootstrap.Enabled {
+		v.positive("tls-bootstrap-cert-validity", c.TLSBootstrap.CertValidity)
+		v.positive("tls-bootstrap-rotate-before", c.TLSBootstrap.RotateBefore)
+		v.positive("tls-bootstrap-check-interval", c.TLSBootstrap.CheckInterval)
+		if c.TLSBootstrap.RotateBefore >= c.TLSBootstrap.CertValidity {
+			v.problem("tls-bootstrap-rotate-before %s must be shorter than tls-bootstrap-cert-validity %s", c.TLSBootstrap.RotateBefore, c.TLSBootstrap.CertValidity)
+		}
+	}
+	if c.SidecarModeOrDefault() == SidecarModeAuto {
+		v.positive("server-version-refresh", c.ServerVersionRefresh)
+	}
+
+	// Syntax
+	v.image("init-image", c.InitImage)
+	v.image("sidecar-image", c.SidecarImage)
+	v.mountPoint("init-mount-point", c.InitMountPoint)
+	v.mountPoint("sidecar-mount-point", c.SidecarMountPoint)
+	v.hosts("gateway", c.Gateway)
+	v.hosts("dns", c.DNS)
+
+	if len(v.problems) > 0 {
+		return ValidationError{Problems: v.problems}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/angelnu/gateway-admision-controller/internal/config"
+)
+
+func TestValidate(t *testing.T) {
+	tests := map[string]struct {
+		cfg         config.CmdConfig
+		expProblems []string
+	}{
+		"Empty": {},
+		"Valid": {
+			cfg: config.CmdConfig{
+				Gateway:           "gateway.vpn.svc.cluster.local",
+				DNS:               "10.0.0.1,dns.example.com",
+				DNSPolicy:         "None",
+				ClusterDomain:     "cluster.local",
+				InitImage:         "ghcr.io/angelnu/pod-gateway:v1.8.1",
+				InitImagePullPol:  "IfNotPresent",
+				InitMountPoint:    "/config/{{ .Namespace }}",
+				SidecarImage:      "registry.local:5000/pod-gateway@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+				SidecarMountPoint: "/config",
+				ConfigmapName:     "settings",
+				LogLevel:          "info,mutator=trace",
+				TLSCertFilePath:   "/tls/tls.crt",
+				TLSKeyFilePath:    "/tls/tls.key",
+				TLSReloadInterval: 10 * time.Second,
+				TLSClientCAFile:   "/tls/ca.crt",
+				AdminTokenFile:    "/admin/token",
+				AdminListenAddr:   ":8443",
+			},
+		},
+		"Valid TLS bootstrap": {
+			cfg: config.CmdConfig{
+				ClusterDomain: "cluster.example.com",
+				TLSBootstrap: config.TLSBootstrapConfig{
+					Enabled:           true,
+					ServiceName:       "gateway-admision-controller",
+					SecretName:        "gateway-admision-controller-tls",
+					WebhookConfigName: "gateway-admision-controller",
+					CertValidity:      8760 * time.Hour,
+					RotateBefore:      720 * time.Hour,
+					CheckInterval:     time.Hour,
+				},
+			},
+		},
+		"DNS settings for the pods overriding the DNSPolicy": {
+			cfg: config.CmdConfig{
+				DNS:                 "gateway.vpn.svc.cluster.local.",
+				ClusterDomain:       "cluster.local",
+				DNSSearch:           "lan",
+				DNSOptions:          "ndots:2",
+				AllowedDNSOverrides: "dns, dns-policy",
+			},
+		},
+		"Invalid enums": {
+			cfg: config.CmdConfig{
+				DNS:                 "10.0.0.1",
+				DNSPolicy:           "none",
+				InitImage:           "busybox",
+				InitImagePullPol:    "Sometimes",
+				SidecarImage:        "busybox",
+				SidecarImagePullPol: "always",
+				FailurePolicyDNS:    "retry",
+				LogLevel:            "loud",
+			},
+			expProblems: []string{
+				`dns-policy "none" must be one of ClusterFirst, ClusterFirstWithHostNet, Default, None`,
+				`init-image-pull-policy "Sometimes" must be one of Always, IfNotPresent, Never`,
+				`sidecar-image-pull-policy "always" must be one of Always, IfNotPresent, Never`,
+				`failure-policy-dns "retry" must be one of deny, allow, last-known-good`,
+				`log-level: invalid log level "loud": use error, warning, info, debug or trace`,
+			},
+		},
+		"Missing dependencies": {
+			cfg: config.CmdConfig{
+				SetGatewayLabelValue:      "vpn",
+				SetGatewayAnnotationValue: "vpn",
+				InitCmd:                   "/bin/init",
+				InitMountPoint:            "/config",
+				DNSPolicy:                 "ClusterFirst",
+				DNSSearch:                 "lan",
+				TLSCertFilePath:           "/tls/tls.crt",
+				TLSReloadInterval:         10 * time.Second,
+			},
+			expProblems: []string{
+				"set-gateway-label-value requires set-gateway-label",
+				"set-gateway-annotation-value requires set-gateway-annotation",
+				"init-cmd requires init-image",
+				"init-mount-point requires configmap-name",
+				"dns-search requires dns-policy None",
+				"tls-cert-file-path requires tls-key-file-path",
+			},
+		},
+		"Admin listener without token and TLS": {
+			cfg: config.CmdConfig{AdminListenAddr: ":8443"},
+			expProblems: []string{
+				"admin-listen-address requires admin-token-file",
+				"admin-listen-address requires TLS",
+			},
+		},
+		"DNSPolicy None without DNS": {
+			cfg:         config.CmdConfig{DNSPolicy: "None"},
+			expProblems: []string{"dns-policy None requires dns"},
+		},
+		"Sidecar auto mode without version refresh": {
+			cfg:         config.CmdConfig{SidecarMode: "auto"},
+			expProblems: []string{"server-version-refresh 0s must be positive"},
+		},
+		"TLS bootstrap without names": {
+			cfg: config.CmdConfig{
+				TLSBootstrap: config.TLSBootstrapConfig{Enabled: true, CertValidity: 8760 * time.Hour, RotateBefore: 720 * time.Hour, CheckInterval: time.Hour},
+			},
+			expProblems: []string{
+				"tls-bootstrap requires tls-bootstrap-service-name",
+				"tls-bootstrap requires tls-bootstrap-secret-name",
+				"tls-bootstrap requires tls-bootstrap-webhook-config-name",
+			},
+		},
+		"Negative limits and durations": {
+			cfg: config.CmdConfig{
+				WebhookMaxInFlight:      -1,
+				WebhookReadTimeout:      -time.Second,
+				WebhookWriteTimeout:     -time.Second,
+				WebhookIdleTimeout:      -time.Second,
+				WebhookAdmissionTimeout: -time.Second,
+				ShutdownDelay:           -time.Second,
+				ShutdownDrainTimeout:    -time.Second,
+			},
+			expProblems: []string{
+				"webhook-max-inflight -1 must not be negative",
+				"webhook-read-timeout -1s must not be negative",
+				"webhook-write-timeout -1s must not be negative",
+				"webhook-idle-timeout -1s must not be negative",
+				"webhook-admission-timeout -1s must not be negative",
+				"shutdown-delay -1s must not be negative",
+				"shutdown-drain-timeout -1s must not be negative",
+			},
+		},
+		"Intervals and validities that are not positive": {
+			cfg: config.CmdConfig{
+				TLSCertFilePath: "/tls/tls.crt",
+				TLSKeyFilePath:  "/tls/tls.key",
+				TLSBootstrap: config.TLSBootstrapConfig{
+					Enabled:           true,
+					ServiceName:       "gateway-admision-controller",
+					SecretName:        "gateway-admision-controller-tls",
+					WebhookConfigName: "gateway-admision-controller",
+					CertValidity:      8760 * time.Hour,
+					RotateBefore:      -time.Hour,
+				},
+			},
+			expProblems: []string{
+				"tls-reload-interval 0s must be positive",
+				"tls-bootstrap-rotate-before -1h0m0s must be positive",
+				"tls-bootstrap-check-interval 0s must be positive",
+			},
+		},
+		"Rotation not before the certificate expires": {
+			cfg: config.CmdConfig{
+				TLSBootstrap: config.TLSBootstrapConfig{
+					Enabled:           true,
+					ServiceName:       "gateway-admision-controller",
+					SecretName:        "gateway-admision-controller-tls",
+					WebhookConfigName: "gateway-admision-controller",
+					CertValidity:      720 * time.Hour,
+					RotateBefore:      720 * time.Hour,
+					CheckInterval:     time.Hour,
+				},
+			},
+			expProblems: []string{"tls-bootstrap-rotate-before 720h0m0s must be shorter than tls-bootstrap-cert-validity 720h0m0s"},
+		},
+		"Invalid syntax": {
+			cfg: config.CmdConfig{
+				Gateway:           "gateway_pod",
+				DNS:               "10.0.0.1, 10.0.0.2",
+				InitImage:         "Busybox:latest",
+				SidecarImage:      "busybox:",
+				SidecarMountPoint: "config",
+				ConfigmapName:     "settings",
+			},
+			expProblems: []string{
+				`init-image "Busybox:latest" is not a valid image reference`,
+				`sidecar-image "busybox:" is not a valid image reference`,
+				`sidecar-mount-point "config" must be an absolute path`,
+				`gateway "gateway_pod" is not an IP or DNS name`,
+				`dns " 10.0.0.2" is not an IP or DNS name`,
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := test.cfg.Validate()
+			if test.expProblems == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var validationErr config.ValidationError
+			if assert.ErrorAs(t, err, &validationErr) {
+				assert.Equal(t, test.expProblems, validationErr.Problems)
+			}
+		})
+	}
+}
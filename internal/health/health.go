@@ -0,0 +1,186 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/angelnu/gateway-admision-controller/internal/log"
+)
+
+const (
+	// LivenessPath only reflects the process health.
+	LivenessPath = "/livez"
+	// ReadinessPath reflects if the webhook can mutate pods.
+	ReadinessPath = "/readyz"
+)
+
+// Check returns an error when the checked component is not ready.
+type Check func(ctx context.Context) error
+
+// Config is the health checker configuration.
+type Config struct {
+	// Timeout bounds all the readiness checks of a probe.
+	Timeout time.Duration
+	Logger  log.Logger
+}
+
+func (c *Config) defaults() error {
+
+	if c.Timeout <= 0 {
+		c.Timeout = 5 * time.Second
+	}
+
+	if c.Logger == nil {
+		c.Logger = log.Dummy
+	}
+
+	return nil
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker serves the liveness and readiness endpoints.
+type Checker struct {
+	cfg    Config
+	logger log.Logger
+
+	mu       sync.RWMutex
+	checks   []namedCheck
+	draining atomic.Bool
+}
+
+// CheckResult is the result of a single readiness check.
+type CheckResult struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Status is the body of the probe endpoints.
+type Status struct {
+	OK     bool                   `json:"ok"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// New returns a new Checker.
+func New(config Config) (*Checker, error) {
+	err := config.defaults()
+	if err != nil {
+		return nil, fmt.Errorf("health configuration is not valid: %w", err)
+	}
+
+	return &Checker{
+		cfg:    config,
+		logger: config.Logger.WithKV(log.KV{"service": "health"}),
+	}, nil
+}
+
+// AddReadinessCheck adds a check to the readiness endpoint.
+func (c *Checker) AddReadinessCheck(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// SetDraining makes the readiness fail so no new requests are routed to this replica.
+func (c *Checker) SetDraining() {
+	c.draining.Store(true)
+}
+
+// Draining tells if the replica is shutting down.
+func (c *Checker) Draining() bool {
+	return c.draining.Load()
+}
+
+// Ready runs all the readiness checks. The checks are skipped while draining.
+func (c *Checker) Ready(ctx context.Context) Status {
+	if c.Draining() {
+		return Status{OK: false, Checks: map[string]CheckResult{
+			"shutdown": {OK: false, Error: "shutting down"},
+		}}
+	}
+
+	c.mu.RLock()
+	checks := c.checks
+	c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	status := Status{OK: true, Checks: map[string]CheckResult{}}
+	for _, check := range checks {
+		result := CheckResult{OK: true}
+		if err := check.check(ctx); err != nil {
+			result = CheckResult{OK: false, Error: err.Error()}
+			status.OK = false
+		}
+		status.Checks[check.name] = result
+	}
+	return status
+}
+
+// LivenessHandler returns ok while the process can serve requests.
+func (c *Checker) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.write(w, Status{OK: true})
+	})
+}
+
+// ReadinessHandler returns the result of every readiness check.
+func (c *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := c.Ready(r.Context())
+		if !status.OK {
+			c.logger.WithKV(log.KV{"checks": status.Checks}).Warningf("not ready")
+		}
+		c.write(w, status)
+	})
+}
+
+// Register adds the probe endpoints to the router.
+func (c *Checker) Register(router *http.ServeMux) {
+	router.Handle(LivenessPath, c.LivenessHandler())
+	router.Handle(ReadinessPath, c.ReadinessHandler())
+}
+
+func (c *Checker) write(w http.ResponseWriter, status Status) {
+	w.Header().Set("Content-Type", "application/json")
+	if !status.OK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// ResolveCheck fails when any of the hosts cannot be resolved.
+func ResolveCheck(hosts ...string) Check {
+	return func(ctx context.Context) error {
+		for _, host := range hosts {
+			if _, err := net.DefaultResolver.LookupIP(ctx, "ip", host); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// CertificateCheck fails when the certificate returned by notAfter has expired.
+func CertificateCheck(notAfter func() time.Time) Check {
+	return func(_ context.Context) error {
+		expiry := notAfter()
+		if expiry.IsZero() {
+			return fmt.Errorf("no certificate loaded")
+		}
+		if time.Now().After(expiry) {
+			return fmt.Errorf("certificate expired at %s", expiry.Format(time.RFC3339))
+		}
+		return nil
+	}
+}
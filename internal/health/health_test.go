@@ -0,0 +1,142 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/angelnu/gateway-admision-controller/internal/health"
+)
+
+func TestChecker(t *testing.T) {
+	tests := map[string]struct {
+		checks    map[string]health.Check
+		path      string
+		expCode   int
+		expStatus health.Status
+	}{
+		"Liveness ignores the readiness checks": {
+			checks: map[string]health.Check{
+				"failing": func(context.Context) error { return fmt.Errorf("down") },
+			},
+			path:      health.LivenessPath,
+			expCode:   http.StatusOK,
+			expStatus: health.Status{OK: true},
+		},
+		"Ready without checks": {
+			path:      health.ReadinessPath,
+			expCode:   http.StatusOK,
+			expStatus: health.Status{OK: true},
+		},
+		"Ready when all checks pass": {
+			checks: map[string]health.Check{
+				"gateway": func(context.Context) error { return nil },
+				"config":  func(context.Context) error { return nil },
+			},
+			path:    health.ReadinessPath,
+			expCode: http.StatusOK,
+			expStatus: health.Status{OK: true, Checks: map[string]health.CheckResult{
+				"gateway": {OK: true},
+				"config":  {OK: true},
+			}},
+		},
+		"Not ready when a check fails": {
+			checks: map[string]health.Check{
+				"gateway": func(context.Context) error { return fmt.Errorf("no such host") },
+				"config":  func(context.Context) error { return nil },
+			},
+			path:    health.ReadinessPath,
+			expCode: http.StatusServiceUnavailable,
+			expStatus: health.Status{OK: false, Checks: map[string]health.CheckResult{
+				"gateway": {OK: false, Error: "no such host"},
+				"config":  {OK: true},
+			}},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			checker, err := health.New(health.Config{})
+			require.NoError(err)
+			for name, check := range test.checks {
+				checker.AddReadinessCheck(name, check)
+			}
+			router := http.NewServeMux()
+			checker.Register(router)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+			assert.Equal(test.expCode, w.Code)
+			var gotStatus health.Status
+			require.NoError(json.Unmarshal(w.Body.Bytes(), &gotStatus))
+			assert.Equal(test.expStatus, gotStatus)
+		})
+	}
+}
+
+func TestCheckerDraining(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	checker, err := health.New(health.Config{})
+	require.NoError(err)
+	checker.AddReadinessCheck("config", func(context.Context) error { return nil })
+	router := http.NewServeMux()
+	checker.Register(router)
+
+	checker.SetDraining()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, health.ReadinessPath, nil))
+	assert.Equal(http.StatusServiceUnavailable, w.Code)
+	var gotStatus health.Status
+	require.NoError(json.Unmarshal(w.Body.Bytes(), &gotStatus))
+	assert.Equal(health.Status{OK: false, Checks: map[string]health.CheckResult{
+		"shutdown": {OK: false, Error: "shutting down"},
+	}}, gotStatus)
+
+	// The process is still alive while draining
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, health.LivenessPath, nil))
+	assert.Equal(http.StatusOK, w.Code)
+}
+
+func TestCertificateCheck(t *testing.T) {
+	tests := map[string]struct {
+		notAfter time.Time
+		expErr   bool
+	}{
+		"No certificate": {
+			expErr: true,
+		},
+		"Expired certificate": {
+			notAfter: time.Now().Add(-time.Minute),
+			expErr:   true,
+		},
+		"Valid certificate": {
+			notAfter: time.Now().Add(time.Hour),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := health.CertificateCheck(func() time.Time { return test.notAfter })(context.Background())
+			if test.expErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/angelnu/gateway-admision-controller/internal/log"
+)
+
+const (
+	// PathPrefix is where the admin endpoints are served.
+	PathPrefix = "/admin/"
+	// LogLevelPath reads and changes the log levels.
+	LogLevelPath = PathPrefix + "log-level"
+	// ConfigPath shows the effective configuration.
+	ConfigPath = PathPrefix + "config"
+)
+
+// Config is the admin endpoints configuration.
+type Config struct {
+	// Token must be sent as bearer token by the admin requests.
+	Token  string
+	Levels *log.Levels
+	// EffectiveConfig returns the configuration in use, encoded as JSON. Secrets must
+	// be redacted. The config endpoint is not served without it.
+	EffectiveConfig func() interface{}
+	Logger          log.Logger
+}
+
+func (c *Config) defaults() error {
+
+	if c.Token == "" {
+		return fmt.Errorf("token is required")
+	}
+
+	if c.Levels == nil {
+		return fmt.Errorf("log levels are required")
+	}
+
+	if c.Logger == nil {
+		c.Logger = log.Dummy
+	}
+
+	return nil
+}
+
+// LoadToken reads the admin token from a file.
+func LoadToken(tokenFile string) (string, error) {
+	data, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("could not read admin token: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("admin token file %s is empty", tokenFile)
+	}
+	return token, nil
+}
+
+type handler struct {
+	handler         http.Handler
+	token           []byte
+	levels          *log.Levels
+	effectiveConfig func() interface{}
+	logger          log.Logger
+}
+
+// New returns the admin endpoints handler. Every request must be authenticated.
+func New(config Config) (http.Handler, error) {
+	err := config.defaults()
+	if err != nil {
+		return nil, fmt.Errorf("admin configuration is not valid: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	h := handler{
+		handler:         mux,
+		token:           []byte(config.Token),
+		levels:          config.Levels,
+		effectiveConfig: config.EffectiveConfig,
+		logger:          config.Logger.WithKV(log.KV{"service": "admin"}),
+	}
+	mux.HandleFunc(LogLevelPath, h.logLevel)
+	if h.effectiveConfig != nil {
+		mux.HandleFunc(ConfigPath, h.config)
+	}
+
+	return h, nil
+}
+
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), h.token) != 1 {
+		h.logger.WithKV(log.KV{"remote": r.RemoteAddr, "path": r.URL.Path}).Warningf("rejected unauthenticated admin request")
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	h.handler.ServeHTTP(w, r)
+}
+
+// logLevels is the body of the log level endpoint.
+type logLevels struct {
+	Default    string            `json:"default"`
+	Components map[string]string `json:"components"`
+}
+
+// logLevel returns the log levels on GET. PUT sets the level of the component
+// query parameter, or the default level without it. An empty level resets the
+// component to the default level.
+func (h handler) logLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		component := r.URL.Query().Get("component")
+		levelName := r.URL.Query().Get("level")
+		if component != "" && levelName == "" {
+			if err := h.levels.Unset(component); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		} else {
+			level, err := log.ParseLevel(levelName)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := h.levels.Set(component, level); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		h.logger.WithKV(log.KV{"remote": r.RemoteAddr, "log-component": component, "level": levelName}).Infof("log level changed")
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	def, components := h.levels.Snapshot()
+	body := logLevels{Default: def.String(), Components: map[string]string{}}
+	for component, level := range components {
+		body.Components[component] = level.String()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+// config returns the effective configuration, it is read-only.
+func (h handler) config(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.effectiveConfig())
+}
@@ -0,0 +1,169 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/angelnu/gateway-admision-controller/internal/http/admin"
+	"github.com/angelnu/gateway-admision-controller/internal/log"
+)
+
+const testToken = "s3cr3t"
+
+func TestLogLevel(t *testing.T) {
+	tests := map[string]struct {
+		method        string
+		query         string
+		token         string
+		expCode       int
+		expDefault    string
+		expComponents map[string]string
+	}{
+		"Without token": {
+			method:  http.MethodGet,
+			expCode: http.StatusUnauthorized,
+		},
+		"With a wrong token": {
+			method:  http.MethodGet,
+			token:   "guess",
+			expCode: http.StatusUnauthorized,
+		},
+		"Get the levels": {
+			method:        http.MethodGet,
+			token:         testToken,
+			expCode:       http.StatusOK,
+			expDefault:    "info",
+			expComponents: map[string]string{"resolver": "debug"},
+		},
+		"Set the default level": {
+			method:        http.MethodPut,
+			query:         "level=debug",
+			token:         testToken,
+			expCode:       http.StatusOK,
+			expDefault:    "debug",
+			expComponents: map[string]string{"resolver": "debug"},
+		},
+		"Set a component level": {
+			method:        http.MethodPut,
+			query:         "component=mutator&level=trace",
+			token:         testToken,
+			expCode:       http.StatusOK,
+			expDefault:    "info",
+			expComponents: map[string]string{"resolver": "debug", "mutator": "trace"},
+		},
+		"Reset a component level": {
+			method:        http.MethodPut,
+			query:         "component=resolver",
+			token:         testToken,
+			expCode:       http.StatusOK,
+			expDefault:    "info",
+			expComponents: map[string]string{},
+		},
+		"Invalid level": {
+			method:  http.MethodPut,
+			query:   "level=loud",
+			token:   testToken,
+			expCode: http.StatusBadRequest,
+		},
+		"Unknown component": {
+			method:  http.MethodPut,
+			query:   "component=dns&level=debug",
+			token:   testToken,
+			expCode: http.StatusBadRequest,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			levels, err := log.ParseLevels("info,resolver=debug")
+			require.NoError(err)
+			h, err := admin.New(admin.Config{Token: testToken, Levels: levels})
+			require.NoError(err)
+
+			r := httptest.NewRequest(test.method, admin.LogLevelPath+"?"+test.query, nil)
+			if test.token != "" {
+				r.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			assert.Equal(test.expCode, w.Code)
+			if test.expCode != http.StatusOK {
+				return
+			}
+			var body struct {
+				Default    string            `json:"default"`
+				Components map[string]string `json:"components"`
+			}
+			require.NoError(json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(test.expDefault, body.Default)
+			assert.Equal(test.expComponents, body.Components)
+		})
+	}
+}
+
+func TestConfig(t *testing.T) {
+	tests := map[string]struct {
+		method          string
+		token           string
+		effectiveConfig func() interface{}
+		expCode         int
+		expBody         string
+	}{
+		"Without token": {
+			method:          http.MethodGet,
+			effectiveConfig: func() interface{} { return map[string]string{"version": "v1"} },
+			expCode:         http.StatusUnauthorized,
+		},
+		"Get the config": {
+			method:          http.MethodGet,
+			token:           testToken,
+			effectiveConfig: func() interface{} { return map[string]string{"version": "v1"} },
+			expCode:         http.StatusOK,
+			expBody:         `{"version":"v1"}`,
+		},
+		"Read-only": {
+			method:          http.MethodPut,
+			token:           testToken,
+			effectiveConfig: func() interface{} { return map[string]string{"version": "v1"} },
+			expCode:         http.StatusMethodNotAllowed,
+		},
+		"Not served without config": {
+			method:  http.MethodGet,
+			token:   testToken,
+			expCode: http.StatusNotFound,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			levels, err := log.ParseLevels("info")
+			require.NoError(err)
+			h, err := admin.New(admin.Config{Token: testToken, Levels: levels, EffectiveConfig: test.effectiveConfig})
+			require.NoError(err)
+
+			r := httptest.NewRequest(test.method, admin.ConfigPath, nil)
+			if test.token != "" {
+				r.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			assert.Equal(test.expCode, w.Code)
+			if test.expCode == http.StatusOK {
+				assert.JSONEq(test.expBody, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package clientauth
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/angelnu/gateway-admision-controller/internal/log"
+	"github.com/angelnu/gateway-admision-controller/internal/metrics"
+)
+
+const (
+	REASON_NO_CERTIFICATE      = "no-certificate"
+	REASON_INVALID_CERTIFICATE = "invalid-certificate"
+	REASON_NAME                = "name-not-allowed"
+)
+
+// Config is the client certificate verification configuration.
+type Config struct {
+	// ClientCAs are the CAs allowed to sign client certificates.
+	ClientCAs *x509.CertPool
+	// AllowedNames restricts the client certificates to these subject common names
+	// or DNS names. Any certificate signed by the client CA is accepted when empty.
+	AllowedNames []string
+	// ExemptPaths are served without client certificate, e.g. probes.
+	ExemptPaths []string
+	Logger      log.Logger
+	Metrics     metrics.Recorder
+}
+
+func (c *Config) defaults() error {
+
+	if c.ClientCAs == nil {
+		return fmt.Errorf("client CAs are required")
+	}
+
+	if c.Logger == nil {
+		c.Logger = log.Dummy
+	}
+
+	if c.Metrics == nil {
+		c.Metrics = metrics.Dummy
+	}
+
+	return nil
+}
+
+// LoadCAs reads a PEM bundle with the CAs allowed to sign client certificates.
+func LoadCAs(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read client CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in client CA bundle %s", caFile)
+	}
+	return pool, nil
+}
+
+type handler struct {
+	next         http.Handler
+	clientCAs    *x509.CertPool
+	allowedNames map[string]bool
+	exemptPaths  map[string]bool
+	logger       log.Logger
+	metrics      metrics.Recorder
+}
+
+// New returns a handler that only lets requests with a valid client certificate
+// reach next. The TLS server must request client certificates (tls.RequestClientCert)
+// so rejected clients are logged and counted here instead of failing the handshake.
+func New(config Config, next http.Handler) (http.Handler, error) {
+	err := config.defaults()
+	if err != nil {
+		return nil, fmt.Errorf("client auth configuration is not valid: %w", err)
+	}
+
+	h := handler{
+		next:         next,
+		clientCAs:    config.ClientCAs,
+		allowedNames: map[string]bool{},
+		exemptPaths:  map[string]bool{},
+		logger:       config.Logger.WithKV(log.KV{"service": "clientauth"}),
+		metrics:      config.Metrics,
+	}
+	for _, name := range config.AllowedNames {
+		h.allowedNames[name] = true
+	}
+	for _, path := range config.ExemptPaths {
+		h.exemptPaths[path] = true
+	}
+
+	return h, nil
+}
+
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.exemptPaths[r.URL.Path] {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		h.reject(w, r, REASON_NO_CERTIFICATE, "")
+		return
+	}
+
+	cert := r.TLS.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, intermediate := range r.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(intermediate)
+	}
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:         h.clientCAs,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		h.reject(w, r, REASON_INVALID_CERTIFICATE, cert.Subject.String())
+		return
+	}
+
+	if !h.allowed(cert) {
+		h.reject(w, r, REASON_NAME, cert.Subject.String())
+		return
+	}
+
+	h.next.ServeHTTP(w, r)
+}
+
+func (h handler) allowed(cert *x509.Certificate) bool {
+	if len(h.allowedNames) == 0 {
+		return true
+	}
+	if h.allowedNames[cert.Subject.CommonName] {
+		return true
+	}
+	for _, name := range cert.DNSNames {
+		if h.allowedNames[name] {
+			return true
+		}
+	}
+	return false
+}
+
+func (h handler) reject(w http.ResponseWriter, r *http.Request, reason string, subject string) {
+	h.logger.WithKV(log.KV{"remote": r.RemoteAddr, "path": r.URL.Path, "reason": reason, "subject": subject}).
+		Warningf("rejected request without a valid client certificate")
+	h.metrics.IncClientRejected(reason)
+	http.Error(w, "client certificate required", http.StatusForbidden)
+}
@@ -0,0 +1,127 @@
+package clientauth_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/angelnu/gateway-admision-controller/internal/http/clientauth"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return testCA{cert: cert, key: key}
+}
+
+func (ca testCA) issue(t *testing.T, commonName string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestClientAuth(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	apiServer := ca.issue(t, "kube-apiserver")
+	otherClient := ca.issue(t, "curious-pod")
+	untrusted := otherCA.issue(t, "kube-apiserver")
+
+	tests := map[string]struct {
+		path    string
+		cert    *x509.Certificate
+		expCode int
+	}{
+		"health without certificate": {
+			path:    "/wh/health",
+			expCode: http.StatusOK,
+		},
+		"webhook without certificate": {
+			path:    "/wh/mutating/setgateway",
+			expCode: http.StatusForbidden,
+		},
+		"webhook with allowed certificate": {
+			path:    "/wh/mutating/setgateway",
+			cert:    apiServer,
+			expCode: http.StatusOK,
+		},
+		"webhook with certificate of a name not allowed": {
+			path:    "/wh/mutating/setgateway",
+			cert:    otherClient,
+			expCode: http.StatusForbidden,
+		},
+		"webhook with certificate of another CA": {
+			path:    "/wh/mutating/setgateway",
+			cert:    untrusted,
+			expCode: http.StatusForbidden,
+		},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	h, err := clientauth.New(clientauth.Config{
+		ClientCAs:    pool,
+		AllowedNames: []string{"kube-apiserver"},
+		ExemptPaths:  []string{"/wh/health"},
+	}, next)
+	require.NoError(t, err)
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, test.path, nil)
+			r.TLS = &tls.ConnectionState{}
+			if test.cert != nil {
+				r.TLS.PeerCertificates = []*x509.Certificate{test.cert}
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, test.expCode, w.Code)
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package inflight
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+)
+
+// Tracker counts the requests being served so shutdown can report how many were drained.
+type Tracker struct {
+	inFlight atomic.Int64
+}
+
+// Handler wraps next counting its requests as in flight until they return.
+func (t *Tracker) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.inFlight.Add(1)
+		defer t.inFlight.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// InFlight returns the number of requests being served.
+func (t *Tracker) InFlight() int64 {
+	return t.inFlight.Load()
+}
+
+// Drain shuts down server, serving the tracked requests, and closes it when ctx expires
+// first. It returns how many of the requests in flight were completed and aborted: only
+// the ones still running when the deadline expired are aborted.
+func (t *Tracker) Drain(ctx context.Context, server *http.Server) (completed int64, aborted int64, err error) {
+	inFlight := t.InFlight()
+	err = server.Shutdown(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		aborted = t.InFlight()
+	}
+	if err != nil {
+		server.Close()
+	}
+	// Requests may still start on the open connections while draining
+	if aborted > inFlight {
+		inFlight = aborted
+	}
+	return inFlight - aborted, aborted, err
+}
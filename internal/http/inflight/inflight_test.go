@@ -0,0 +1,106 @@
+package inflight_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/angelnu/gateway-admision-controller/internal/http/inflight"
+)
+
+func TestTracker(t *testing.T) {
+	assert := assert.New(t)
+
+	var tracker inflight.Tracker
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := tracker.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+
+	done := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go func() {
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+			done <- struct{}{}
+		}()
+		<-started
+	}
+	assert.Equal(int64(2), tracker.InFlight())
+
+	close(release)
+	<-done
+	<-done
+	assert.Equal(int64(0), tracker.InFlight())
+}
+
+func TestTrackerDrain(t *testing.T) {
+	tests := map[string]struct {
+		finishes     bool
+		expCompleted int64
+		expAborted   int64
+		expErr       error
+	}{
+		"Completed": {
+			finishes:     true,
+			expCompleted: 1,
+		},
+		"Aborted at the deadline": {
+			expAborted: 1,
+			expErr:     context.DeadlineExceeded,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			var tracker inflight.Tracker
+			release := make(chan struct{})
+			defer close(release)
+			started := make(chan struct{})
+			server := &http.Server{Handler: tracker.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				if test.finishes {
+					time.Sleep(10 * time.Millisecond)
+					return
+				}
+				<-release
+			}))}
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(err)
+			go server.Serve(listener)
+
+			go func() {
+				resp, err := http.Get("http://" + listener.Addr().String())
+				if err == nil {
+					resp.Body.Close()
+				}
+			}()
+			<-started
+
+			timeout := time.Second
+			if !test.finishes {
+				timeout = 50 * time.Millisecond
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			completed, aborted, err := tracker.Drain(ctx, server)
+			if test.expErr != nil {
+				assert.ErrorIs(err, test.expErr)
+			} else {
+				assert.NoError(err)
+			}
+			assert.Equal(test.expCompleted, completed)
+			assert.Equal(test.expAborted, aborted)
+		})
+	}
+}
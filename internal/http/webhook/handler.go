@@ -7,13 +7,16 @@ import (
 
 	kwhhttp "github.com/slok/kubewebhook/v2/pkg/http"
 	kwhlog "github.com/slok/kubewebhook/v2/pkg/log"
+	kwhotel "github.com/slok/kubewebhook/v2/pkg/tracing/otel"
+	kwhwebhook "github.com/slok/kubewebhook/v2/pkg/webhook"
 	kwhmutating "github.com/slok/kubewebhook/v2/pkg/webhook/mutating"
 
 	"github.com/angelnu/gateway-admision-controller/internal/log"
 	"github.com/angelnu/gateway-admision-controller/internal/mutation"
+	"github.com/angelnu/gateway-admision-controller/internal/tracing"
 )
 
-// kubewebhookLogger is a small proxy to use our logger with Kubewebhook.
+// kubewebhookLogger is a small proxy to use our logger, with any backend, with Kubewebhook.
 type kubewebhookLogger struct {
 	log.Logger
 }
@@ -34,11 +37,18 @@ func (h handler) gatewayPodMutator() (http.Handler, error) {
 	logger := kubewebhookLogger{Logger: h.logger.WithKV(log.KV{"lib": "kubewebhook", "webhook": "gatewayPodMutator"})}
 
 	// Create our mutator
-	gwPodMutator, err := gatewayPodMutator.NewGatewayPodMutator(h.cmdConfig, logger)
+	gwPodMutator, err := gatewayPodMutator.NewGatewayPodMutator(gatewayPodMutator.Config{
+		CmdConfig:      h.cmdConfig,
+		Logger:         logger.WithKV(log.KV{log.ComponentKey: log.ComponentMutator}),
+		NativeSidecar:  h.nativeSidecar,
+		Metrics:        h.metrics,
+		TracerProvider: h.tracerProvider,
+		Status:         h.mutatorStatus,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("error creating webhook mutator: %w", err)
 	}
-	mt := kwhmutating.MutatorFunc(gwPodMutator.GatewayPodMutator)
+	mt := patchTracedMutator(h.tracerProvider.Tracer(tracerName), kwhmutating.MutatorFunc(gwPodMutator.GatewayPodMutator))
 
 	wh, err := kwhmutating.NewWebhook(kwhmutating.WebhookConfig{
 		ID:      "gatewayPodMutator",
@@ -48,9 +58,15 @@ func (h handler) gatewayPodMutator() (http.Handler, error) {
 	if err != nil {
 		return nil, fmt.Errorf("could not create webhook: %w", err)
 	}
+
+	// The HTTP span continues the W3C trace context sent by the API server.
+	tracer := kwhotel.NewTracer(h.tracerProvider, tracing.Propagator)
+	wh = kwhwebhook.NewTracedWebhook(tracer, patchTracedWebhook{Webhook: wh})
+
 	whHandler, err := kwhhttp.HandlerFor(kwhhttp.HandlerConfig{
 		Webhook: wh,
 		Logger:  logger,
+		Tracer:  tracer,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("could not create handler from webhook: %w", err)
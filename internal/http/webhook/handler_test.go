@@ -0,0 +1,46 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	kwhlog "github.com/slok/kubewebhook/v2/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/angelnu/gateway-admision-controller/internal/log"
+	"github.com/angelnu/gateway-admision-controller/internal/log/logtest"
+)
+
+func TestKubewebhookLogger(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	captured := logtest.New()
+	var out bytes.Buffer
+	backends := map[string]log.Logger{
+		"logtest": captured,
+		"slog":    log.NewSlog(slog.NewJSONHandler(&out, nil)),
+	}
+
+	for name, backend := range backends {
+		var logger kwhlog.Logger = kubewebhookLogger{Logger: backend}
+		ctx := logger.SetValuesOnCtx(context.Background(), map[string]interface{}{"request-id": "1234"})
+		logger.WithCtxValues(ctx).WithValues(map[string]interface{}{"op": "create"}).Infof("reviewed by %s", name)
+	}
+
+	assert.Equal([]logtest.Entry{{
+		Level:   log.LevelInfo,
+		Message: "reviewed by logtest",
+		KV:      log.KV{"request-id": "1234", "op": "create"},
+	}}, captured.Entries())
+
+	var entry map[string]interface{}
+	require.NoError(json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal("reviewed by slog", entry["msg"])
+	assert.Equal("1234", entry["request-id"])
+	assert.Equal("create", entry["op"])
+}
@@ -0,0 +1,61 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/angelnu/gateway-admision-controller/internal/log"
+	"github.com/angelnu/gateway-admision-controller/internal/metrics"
+)
+
+// limiter bounds the admissions in flight and how long each of them may take.
+type limiter struct {
+	next     http.Handler
+	inFlight chan struct{}
+	timeout  time.Duration
+	logger   log.Logger
+	metrics  metrics.Recorder
+}
+
+// limit wraps next with the in flight and timeout limits. Zero values disable them.
+func limit(next http.Handler, maxInFlight int, timeout time.Duration, logger log.Logger, metricsRec metrics.Recorder) http.Handler {
+	if maxInFlight <= 0 && timeout <= 0 {
+		return next
+	}
+
+	l := limiter{
+		next:    next,
+		timeout: timeout,
+		logger:  logger,
+		metrics: metricsRec,
+	}
+	if maxInFlight > 0 {
+		l.inFlight = make(chan struct{}, maxInFlight)
+	}
+	return l
+}
+
+func (l limiter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if l.inFlight != nil {
+		select {
+		case l.inFlight <- struct{}{}:
+			defer func() { <-l.inFlight }()
+		default:
+			// Shed the request instead of queueing it past the API server timeout.
+			l.logger.WithKV(log.KV{"remote": r.RemoteAddr}).Warningf("too many admissions in flight, request rejected")
+			l.metrics.IncAdmissionShed()
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many admission requests in flight", http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	if l.timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), l.timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+
+	l.next.ServeHTTP(w, r)
+}
@@ -0,0 +1,62 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/angelnu/gateway-admision-controller/internal/log"
+	"github.com/angelnu/gateway-admision-controller/internal/metrics"
+)
+
+func TestLimitShedsRequestsOverMaxInFlight(t *testing.T) {
+	assert := assert.New(t)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	})
+	h := limit(next, 1, 0, log.Dummy, metrics.Dummy)
+
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, MutatingPath, nil))
+		done <- w.Code
+	}()
+	<-started
+
+	// The only slot is taken
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, MutatingPath, nil))
+	assert.Equal(http.StatusTooManyRequests, w.Code)
+	assert.Equal("1", w.Header().Get("Retry-After"))
+
+	close(release)
+	assert.Equal(http.StatusOK, <-done)
+
+	// The slot is free again
+	go func() { <-started }()
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, MutatingPath, nil))
+	assert.Equal(http.StatusOK, w.Code)
+}
+
+func TestLimitSetsAdmissionDeadline(t *testing.T) {
+	var deadline time.Time
+	var ok bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok = r.Context().Deadline()
+	})
+	h := limit(next, 0, time.Minute, log.Dummy, metrics.Dummy)
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, MutatingPath, nil))
+
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, 5*time.Second)
+}
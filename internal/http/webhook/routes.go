@@ -5,6 +5,13 @@ import (
 	"net/http"
 )
 
+const (
+	// MutatingPath receives the admission reviews from the API server.
+	MutatingPath = "/wh/mutating/setgateway"
+	// HealthPath is the health endpoint.
+	HealthPath = "/wh/health"
+)
+
 // routes wires the routes to handlers on a specific router.
 func (h handler) routes(router *http.ServeMux) error {
 
@@ -13,11 +20,15 @@ func (h handler) routes(router *http.ServeMux) error {
 	if err != nil {
 		return err
 	}
-	router.Handle("/wh/mutating/setgateway", gatewayPodMutator)
+	router.Handle(MutatingPath, limit(gatewayPodMutator, h.maxInFlight, h.timeout, h.logger, h.metrics))
 
 	//Add health
-	router.HandleFunc("/wh/health", func(w http.ResponseWriter, r *http.Request) {
-		// an example API handler
+	router.HandleFunc(HealthPath, func(w http.ResponseWriter, r *http.Request) {
+		if h.draining() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]bool{"ok": false})
+			return
+		}
 		json.NewEncoder(w).Encode(map[string]bool{"ok": true})
 	})
 
@@ -0,0 +1,51 @@
+package webhook
+
+import (
+	"context"
+
+	kwhmodel "github.com/slok/kubewebhook/v2/pkg/model"
+	kwhwebhook "github.com/slok/kubewebhook/v2/pkg/webhook"
+	kwhmutating "github.com/slok/kubewebhook/v2/pkg/webhook/mutating"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const tracerName = "github.com/angelnu/gateway-admision-controller/internal/http/webhook"
+
+// Kubewebhook generates the JSON patch after the mutator returns and before the review
+// returns, so the patch span is started by the mutator and ended by the webhook.
+type patchSpanKey struct{}
+
+type patchSpan struct {
+	span oteltrace.Span
+}
+
+// patchTracedWebhook ends the patch span started by patchTracedMutator.
+type patchTracedWebhook struct {
+	kwhwebhook.Webhook
+}
+
+func (w patchTracedWebhook) Review(ctx context.Context, ar kwhmodel.AdmissionReview) (kwhmodel.AdmissionResponse, error) {
+	holder := &patchSpan{}
+	resp, err := w.Webhook.Review(context.WithValue(ctx, patchSpanKey{}, holder), ar)
+	if holder.span != nil {
+		if err != nil {
+			holder.span.RecordError(err)
+			holder.span.SetStatus(codes.Error, err.Error())
+		}
+		holder.span.End()
+	}
+	return resp, err
+}
+
+// patchTracedMutator starts the patch span when next mutated the object.
+func patchTracedMutator(tracer oteltrace.Tracer, next kwhmutating.Mutator) kwhmutating.Mutator {
+	return kwhmutating.MutatorFunc(func(ctx context.Context, ar *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhmutating.MutatorResult, error) {
+		res, err := next.Mutate(ctx, ar, obj)
+		if holder, ok := ctx.Value(patchSpanKey{}).(*patchSpan); ok && err == nil {
+			_, holder.span = tracer.Start(ctx, "jsonpatch.Create")
+		}
+		return res, err
+	})
+}
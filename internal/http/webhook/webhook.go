@@ -3,15 +3,32 @@ package webhook
 import (
 	"fmt"
 	"net/http"
+	"time"
+
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 
 	"github.com/angelnu/gateway-admision-controller/internal/config"
 	"github.com/angelnu/gateway-admision-controller/internal/log"
+	"github.com/angelnu/gateway-admision-controller/internal/metrics"
+	gatewayPodMutator "github.com/angelnu/gateway-admision-controller/internal/mutation"
 )
 
 // Config is the handler configuration.
 type Config struct {
-	CmdConfig config.CmdConfig
-	Logger    log.Logger
+	CmdConfig     config.CmdConfig
+	Logger        log.Logger
+	NativeSidecar gatewayPodMutator.NativeSidecarSupport
+	// MaxInFlight admissions, more are rejected with 429. Unlimited when 0.
+	MaxInFlight int
+	// Timeout of each admission, lookups are cancelled when it expires. Unbounded when 0.
+	Timeout time.Duration
+	// Draining makes the health endpoint fail while shutting down.
+	Draining       func() bool
+	Metrics        metrics.Recorder
+	TracerProvider oteltrace.TracerProvider
+	// MutatorStatus records what the mutator uses, for the admin endpoints.
+	MutatorStatus *gatewayPodMutator.Status
 }
 
 func (c *Config) defaults() error {
@@ -20,13 +37,32 @@ func (c *Config) defaults() error {
 		c.Logger = log.Dummy
 	}
 
+	if c.Draining == nil {
+		c.Draining = func() bool { return false }
+	}
+
+	if c.Metrics == nil {
+		c.Metrics = metrics.Dummy
+	}
+
+	if c.TracerProvider == nil {
+		c.TracerProvider = noop.NewTracerProvider()
+	}
+
 	return nil
 }
 
 type handler struct {
-	handler   http.Handler
-	cmdConfig config.CmdConfig
-	logger    log.Logger
+	handler        http.Handler
+	cmdConfig      config.CmdConfig
+	nativeSidecar  gatewayPodMutator.NativeSidecarSupport
+	maxInFlight    int
+	timeout        time.Duration
+	draining       func() bool
+	logger         log.Logger
+	metrics        metrics.Recorder
+	tracerProvider oteltrace.TracerProvider
+	mutatorStatus  *gatewayPodMutator.Status
 }
 
 // New returns a new webhook handler.
@@ -39,9 +75,16 @@ func New(config Config) (http.Handler, error) {
 	mux := http.NewServeMux()
 
 	h := handler{
-		handler:   mux,
-		cmdConfig: config.CmdConfig,
-		logger:    config.Logger.WithKV(log.KV{"service": "webhook-handler"}),
+		handler:        mux,
+		cmdConfig:      config.CmdConfig,
+		nativeSidecar:  config.NativeSidecar,
+		maxInFlight:    config.MaxInFlight,
+		timeout:        config.Timeout,
+		draining:       config.Draining,
+		logger:         config.Logger.WithKV(log.KV{"service": "webhook-handler", log.ComponentKey: log.ComponentWebhook}),
+		metrics:        config.Metrics,
+		tracerProvider: config.TracerProvider,
+		mutatorStatus:  config.MutatorStatus,
 	}
 
 	// Register all the routes with our router.
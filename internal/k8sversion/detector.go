@@ -0,0 +1,101 @@
+package k8sversion
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery"
+
+	"github.com/angelnu/gateway-admision-controller/internal/log"
+)
+
+var (
+	// NativeSidecarVersion is the first Kubernetes version with native sidecars enabled by default.
+	NativeSidecarVersion = version.MajorMinor(1, 29)
+)
+
+// DefaultInterval is how often the version is refreshed when no interval is set.
+const DefaultInterval = 10 * time.Minute
+
+// Detector discovers the API server version and caches it.
+type Detector struct {
+	client   discovery.ServerVersionInterface
+	interval time.Duration
+	logger   log.Logger
+
+	mu      sync.RWMutex
+	version *version.Version
+}
+
+// NewDetector returns a new Detector that refreshes the version every interval when running.
+// DefaultInterval is used when interval is not positive.
+func NewDetector(client discovery.ServerVersionInterface, interval time.Duration, logger log.Logger) *Detector {
+	if logger == nil {
+		logger = log.Dummy
+	}
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Detector{
+		client:   client,
+		interval: interval,
+		logger:   logger.WithKV(log.KV{"service": "k8s-version-detector"}),
+	}
+}
+
+// Refresh queries the API server version.
+// On errors the previously discovered version is kept.
+func (d *Detector) Refresh() error {
+	info, err := d.client.ServerVersion()
+	if err != nil {
+		return fmt.Errorf("could not get the API server version: %w", err)
+	}
+	v, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return fmt.Errorf("could not parse the API server version %q: %w", info.GitVersion, err)
+	}
+
+	d.mu.Lock()
+	changed := d.version == nil || !d.version.EqualTo(v)
+	d.version = v
+	d.mu.Unlock()
+
+	if changed {
+		d.logger.Infof("API server version is %s, native sidecars supported: %t", v, d.NativeSidecarSupported())
+	}
+	return nil
+}
+
+// Run refreshes the version periodically until the context is done.
+func (d *Detector) Run(ctx context.Context) error {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := d.Refresh(); err != nil {
+				d.logger.Warningf("%s", err)
+			}
+		}
+	}
+}
+
+// Version returns the last discovered version or nil if it is not known yet.
+func (d *Detector) Version() *version.Version {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.version
+}
+
+// NativeSidecarSupported tells if init containers with RestartPolicy Always are supported.
+// It is false while the version is unknown.
+func (d *Detector) NativeSidecarSupported() bool {
+	v := d.Version()
+	return v != nil && v.AtLeast(NativeSidecarVersion)
+}
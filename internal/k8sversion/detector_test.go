@@ -0,0 +1,76 @@
+package k8sversion_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/angelnu/gateway-admision-controller/internal/k8sversion"
+)
+
+func TestDetectorNativeSidecarSupported(t *testing.T) {
+
+	tests := map[string]struct {
+		gitVersion   string
+		expSupported bool
+	}{
+		"v1.28":         {gitVersion: "v1.28.5", expSupported: false},
+		"v1.29":         {gitVersion: "v1.29.0", expSupported: true},
+		"v1.31 k3s":     {gitVersion: "v1.31.4+k3s1", expSupported: true},
+		"v1.30 eks":     {gitVersion: "v1.30.8-eks-2d5f260", expSupported: true},
+		"unparseable":   {gitVersion: "unknown", expSupported: false},
+		"empty version": {gitVersion: "", expSupported: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := &fakediscovery.FakeDiscovery{
+				Fake:               &k8stesting.Fake{},
+				FakedServerVersion: &version.Info{GitVersion: test.gitVersion},
+			}
+			d := k8sversion.NewDetector(client, 0, nil)
+			_ = d.Refresh()
+
+			assert.Equal(t, test.expSupported, d.NativeSidecarSupported())
+		})
+	}
+}
+
+func TestDetectorKeepsVersionOnError(t *testing.T) {
+	require := require.New(t)
+
+	fake := &k8stesting.Fake{}
+	client := &fakediscovery.FakeDiscovery{
+		Fake:               fake,
+		FakedServerVersion: &version.Info{GitVersion: "v1.30.1"},
+	}
+	d := k8sversion.NewDetector(client, 0, nil)
+	require.NoError(d.Refresh())
+	require.True(d.NativeSidecarSupported())
+
+	fake.PrependReactor("get", "version", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	require.Error(d.Refresh())
+	require.True(d.NativeSidecarSupported())
+	require.Equal("1.30.1", d.Version().String())
+}
+
+func TestDetectorRunWithoutInterval(t *testing.T) {
+	client := &fakediscovery.FakeDiscovery{
+		Fake:               &k8stesting.Fake{},
+		FakedServerVersion: &version.Info{GitVersion: "v1.30.1"},
+	}
+	d := k8sversion.NewDetector(client, 0, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NoError(t, d.Run(ctx))
+}
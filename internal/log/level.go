@@ -0,0 +1,235 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Level is the severity of a log line.
+type Level int
+
+const (
+	LevelError Level = iota
+	LevelWarning
+	LevelInfo
+	LevelDebug
+	// LevelTrace also logs the whole mutated pods.
+	LevelTrace
+)
+
+var levelNames = map[Level]string{
+	LevelError:   "error",
+	LevelWarning: "warning",
+	LevelInfo:    "info",
+	LevelDebug:   "debug",
+	LevelTrace:   "trace",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel parses error, warning, info, debug or trace.
+func ParseLevel(value string) (Level, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "warn" {
+		return LevelWarning, nil
+	}
+	for level, name := range levelNames {
+		if name == value {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid log level %q: use error, warning, info, debug or trace", value)
+}
+
+// ComponentKey is the KV key naming the component of a logger. Loggers below it
+// in the WithKV hierarchy use the level of the component.
+const ComponentKey = "component"
+
+const (
+	// ComponentWebhook is the webhook HTTP handler and kubewebhook.
+	ComponentWebhook = "webhook"
+	// ComponentMutator is the pod mutation.
+	ComponentMutator = "mutator"
+	// ComponentResolver is the gateway and DNS resolution.
+	ComponentResolver = "resolver"
+)
+
+// Components are the components with their own log level.
+var Components = []string{ComponentWebhook, ComponentMutator, ComponentResolver}
+
+func validComponent(component string) error {
+	for _, c := range Components {
+		if c == component {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown log component %q: use %s", component, strings.Join(Components, ", "))
+}
+
+// Levels are the default log level and the per component overrides. They may be
+// changed at runtime.
+type Levels struct {
+	mu  sync.RWMutex
+	def Level
+	// toggled is the default level before the last Toggle
+	toggled    Level
+	components map[string]Level
+}
+
+// NewLevels returns levels with def as the default level.
+func NewLevels(def Level) *Levels {
+	return &Levels{def: def, toggled: def, components: map[string]Level{}}
+}
+
+// ParseLevels parses a default level followed by comma separated <component>=<level>
+// overrides, e.g. info,mutator=trace.
+func ParseLevels(value string) (*Levels, error) {
+	levels := NewLevels(LevelInfo)
+	for i, part := range strings.Split(value, ",") {
+		component, levelName, found := strings.Cut(part, "=")
+		if !found {
+			if i != 0 {
+				return nil, fmt.Errorf("invalid log level %q: only the first level may omit the component", part)
+			}
+			levelName, component = component, ""
+		}
+		level, err := ParseLevel(levelName)
+		if err != nil {
+			return nil, err
+		}
+		if err := levels.Set(strings.TrimSpace(component), level); err != nil {
+			return nil, err
+		}
+	}
+	return levels, nil
+}
+
+// Set changes the level of a component, or the default level when component is empty.
+func (l *Levels) Set(component string, level Level) error {
+	if component != "" {
+		if err := validComponent(component); err != nil {
+			return err
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if component == "" {
+		l.def = level
+		return nil
+	}
+	l.components[component] = level
+	return nil
+}
+
+// Unset makes a component use the default level again.
+func (l *Levels) Unset(component string) error {
+	if err := validComponent(component); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.components, component)
+	return nil
+}
+
+// Toggle switches the default level between level and the one it had before. When
+// the default level was already level, it switches to info.
+func (l *Levels) Toggle(level Level) Level {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.def != level {
+		l.toggled = l.def
+		l.def = level
+	} else if l.toggled != level {
+		l.def = l.toggled
+	} else {
+		l.def = LevelInfo
+		l.toggled = level
+	}
+	return l.def
+}
+
+// Get returns the level of a component.
+func (l *Levels) Get(component string) Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if level, ok := l.components[component]; ok {
+		return level
+	}
+	return l.def
+}
+
+// Enabled tells if a component logs at level.
+func (l *Levels) Enabled(component string, level Level) bool {
+	return level <= l.Get(component)
+}
+
+// Snapshot returns the default level and the component overrides.
+func (l *Levels) Snapshot() (Level, map[string]Level) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	components := make(map[string]Level, len(l.components))
+	for component, level := range l.components {
+		components[component] = level
+	}
+	return l.def, components
+}
+
+// leveled filters the log lines of next by the level of its component.
+type leveled struct {
+	next      Logger
+	levels    *Levels
+	component string
+}
+
+// WithLevels returns a logger that only logs the lines enabled by levels. The
+// next logger must log every level.
+func WithLevels(next Logger, levels *Levels) Logger {
+	return leveled{next: next, levels: levels}
+}
+
+func (l leveled) Infof(format string, args ...interface{}) {
+	if l.levels.Enabled(l.component, LevelInfo) {
+		l.next.Infof(format, args...)
+	}
+}
+
+func (l leveled) Warningf(format string, args ...interface{}) {
+	if l.levels.Enabled(l.component, LevelWarning) {
+		l.next.Warningf(format, args...)
+	}
+}
+
+func (l leveled) Errorf(format string, args ...interface{}) {
+	if l.levels.Enabled(l.component, LevelError) {
+		l.next.Errorf(format, args...)
+	}
+}
+
+func (l leveled) Debugf(format string, args ...interface{}) {
+	if l.levels.Enabled(l.component, LevelDebug) {
+		l.next.Debugf(format, args...)
+	}
+}
+
+func (l leveled) Tracef(format string, args ...interface{}) {
+	if l.levels.Enabled(l.component, LevelTrace) {
+		l.next.Tracef(format, args...)
+	}
+}
+
+func (l leveled) WithKV(kv KV) Logger {
+	component := l.component
+	if c, ok := kv[ComponentKey].(string); ok {
+		component = c
+	}
+	return leveled{next: l.next.WithKV(kv), levels: l.levels, component: component}
+}
@@ -0,0 +1,129 @@
+package log_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/angelnu/gateway-admision-controller/internal/log"
+	"github.com/angelnu/gateway-admision-controller/internal/log/logtest"
+)
+
+func TestParseLevels(t *testing.T) {
+	tests := map[string]struct {
+		value         string
+		expDefault    log.Level
+		expComponents map[string]log.Level
+		expErr        bool
+	}{
+		"Default level only": {
+			value:         "debug",
+			expDefault:    log.LevelDebug,
+			expComponents: map[string]log.Level{},
+		},
+		"Component levels": {
+			value:         "warn,mutator=trace, resolver=debug",
+			expDefault:    log.LevelWarning,
+			expComponents: map[string]log.Level{"mutator": log.LevelTrace, "resolver": log.LevelDebug},
+		},
+		"Component levels without default": {
+			value:         "webhook=error",
+			expDefault:    log.LevelInfo,
+			expComponents: map[string]log.Level{"webhook": log.LevelError},
+		},
+		"Invalid level": {
+			value:  "verbose",
+			expErr: true,
+		},
+		"Unknown component": {
+			value:  "info,dns=debug",
+			expErr: true,
+		},
+		"Default level not first": {
+			value:  "mutator=debug,info",
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			levels, err := log.ParseLevels(test.value)
+			if test.expErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			def, components := levels.Snapshot()
+			assert.Equal(t, test.expDefault, def)
+			assert.Equal(t, test.expComponents, components)
+		})
+	}
+}
+
+func TestWithLevels(t *testing.T) {
+	assert := assert.New(t)
+
+	captured := logtest.New()
+	levels := log.NewLevels(log.LevelInfo)
+	require.NoError(t, levels.Set(log.ComponentMutator, log.LevelTrace))
+	logger := log.WithLevels(captured, levels)
+	mutatorLogger := logger.WithKV(log.KV{log.ComponentKey: log.ComponentMutator}).WithKV(log.KV{"pod": "test"})
+
+	logger.Debugf("root")
+	logger.Infof("root")
+	mutatorLogger.Tracef("mutator")
+	assert.Equal([]logtest.Entry{
+		{Level: log.LevelInfo, Message: "root", KV: log.KV{}},
+		{Level: log.LevelTrace, Message: "mutator", KV: log.KV{log.ComponentKey: log.ComponentMutator, "pod": "test"}},
+	}, captured.Entries())
+
+	// Runtime changes apply to the existing loggers
+	captured.Reset()
+	require.NoError(t, levels.Unset(log.ComponentMutator))
+	assert.Equal(log.LevelDebug, levels.Toggle(log.LevelDebug))
+	logger.Debugf("root")
+	mutatorLogger.Tracef("mutator")
+	mutatorLogger.Debugf("mutator")
+	assert.Equal([]string{"root", "mutator"}, captured.Messages(log.LevelDebug))
+	assert.Empty(captured.Messages(log.LevelTrace))
+
+	// Toggling again restores the previous level
+	assert.Equal(log.LevelInfo, levels.Toggle(log.LevelDebug))
+}
+
+func TestLevelsToggle(t *testing.T) {
+	tests := map[string]struct {
+		value      string
+		expToggles []log.Level
+	}{
+		"From info": {
+			value:      "info",
+			expToggles: []log.Level{log.LevelDebug, log.LevelInfo, log.LevelDebug},
+		},
+		"From warning": {
+			value:      "warning",
+			expToggles: []log.Level{log.LevelDebug, log.LevelWarning, log.LevelDebug},
+		},
+		"Already debug": {
+			value:      "debug",
+			expToggles: []log.Level{log.LevelInfo, log.LevelDebug, log.LevelInfo},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			levels, err := log.ParseLevels(test.value)
+			require.NoError(t, err)
+			for i, expLevel := range test.expToggles {
+				assert.Equal(t, expLevel, levels.Toggle(log.LevelDebug), "toggle %d", i)
+			}
+		})
+	}
+
+	// Setting the default level does not change where the toggle goes back to
+	levels := log.NewLevels(log.LevelInfo)
+	require.NoError(t, levels.Set("", log.LevelDebug))
+	assert.Equal(t, log.LevelInfo, levels.Toggle(log.LevelDebug))
+}
@@ -13,6 +13,7 @@ type Logger interface {
 	Warningf(format string, args ...interface{})
 	Errorf(format string, args ...interface{})
 	Debugf(format string, args ...interface{})
+	Tracef(format string, args ...interface{})
 	WithKV(KV) Logger
 }
 
@@ -27,6 +28,7 @@ func (d dummy) Infof(format string, args ...interface{})    {}
 func (d dummy) Warningf(format string, args ...interface{}) {}
 func (d dummy) Errorf(format string, args ...interface{})   {}
 func (d dummy) Debugf(format string, args ...interface{})   {}
+func (d dummy) Tracef(format string, args ...interface{})   {}
 func (d dummy) WithKV(KV) Logger                            { return d }
 
 type logger struct {
@@ -0,0 +1,104 @@
+// Package logtest provides a log.Logger that captures the log entries so tests
+// can assert on them.
+package logtest
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/angelnu/gateway-admision-controller/internal/log"
+)
+
+// Entry is a captured log line.
+type Entry struct {
+	Level   log.Level
+	Message string
+	// KV are the fields of the logger and its parents.
+	KV log.KV
+}
+
+type entries struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// Logger captures the entries of every level. The loggers returned by WithKV
+// capture into the same entries.
+type Logger struct {
+	entries *entries
+	kv      log.KV
+}
+
+var _ log.Logger = &Logger{}
+
+// New returns a logger without entries.
+func New() *Logger {
+	return &Logger{entries: &entries{}, kv: log.KV{}}
+}
+
+// Entries returns the captured entries in logging order.
+func (l *Logger) Entries() []Entry {
+	l.entries.mu.Lock()
+	defer l.entries.mu.Unlock()
+	return append([]Entry(nil), l.entries.entries...)
+}
+
+// Messages returns the messages of the captured entries of a level.
+func (l *Logger) Messages(level log.Level) []string {
+	var messages []string
+	for _, e := range l.Entries() {
+		if e.Level == level {
+			messages = append(messages, e.Message)
+		}
+	}
+	return messages
+}
+
+// Reset drops the captured entries.
+func (l *Logger) Reset() {
+	l.entries.mu.Lock()
+	defer l.entries.mu.Unlock()
+	l.entries.entries = nil
+}
+
+func (l *Logger) record(level log.Level, format string, args ...interface{}) {
+	kv := make(log.KV, len(l.kv))
+	for k, v := range l.kv {
+		kv[k] = v
+	}
+
+	l.entries.mu.Lock()
+	defer l.entries.mu.Unlock()
+	l.entries.entries = append(l.entries.entries, Entry{Level: level, Message: fmt.Sprintf(format, args...), KV: kv})
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.record(log.LevelInfo, format, args...)
+}
+
+func (l *Logger) Warningf(format string, args ...interface{}) {
+	l.record(log.LevelWarning, format, args...)
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.record(log.LevelError, format, args...)
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.record(log.LevelDebug, format, args...)
+}
+
+func (l *Logger) Tracef(format string, args ...interface{}) {
+	l.record(log.LevelTrace, format, args...)
+}
+
+func (l *Logger) WithKV(kv log.KV) log.Logger {
+	merged := make(log.KV, len(l.kv)+len(kv))
+	for k, v := range l.kv {
+		merged[k] = v
+	}
+	for k, v := range kv {
+		merged[k] = v
+	}
+	return &Logger{entries: l.entries, kv: merged}
+}
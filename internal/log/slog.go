@@ -0,0 +1,74 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+)
+
+// SlogLevelTrace is the slog level of Tracef, below slog.LevelDebug.
+const SlogLevelTrace = slog.LevelDebug - 4
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlog returns a new log.Logger for a slog handler. The KV of WithKV are added
+// as slog attributes.
+func NewSlog(h slog.Handler) Logger {
+	return slogLogger{logger: slog.New(h)}
+}
+
+func (l slogLogger) log(level slog.Level, format string, args ...interface{}) {
+	ctx := context.Background()
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+	l.logger.Log(ctx, level, fmt.Sprintf(format, args...))
+}
+
+func (l slogLogger) Infof(format string, args ...interface{}) {
+	l.log(slog.LevelInfo, format, args...)
+}
+
+func (l slogLogger) Warningf(format string, args ...interface{}) {
+	l.log(slog.LevelWarn, format, args...)
+}
+
+func (l slogLogger) Errorf(format string, args ...interface{}) {
+	l.log(slog.LevelError, format, args...)
+}
+
+func (l slogLogger) Debugf(format string, args ...interface{}) {
+	l.log(slog.LevelDebug, format, args...)
+}
+
+func (l slogLogger) Tracef(format string, args ...interface{}) {
+	l.log(SlogLevelTrace, format, args...)
+}
+
+func (l slogLogger) WithKV(kv KV) Logger {
+	// Sorted so the attributes keep the same order on every line.
+	keys := make([]string, 0, len(kv))
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]interface{}, 0, len(kv))
+	for _, k := range keys {
+		attrs = append(attrs, slog.Any(k, kv[k]))
+	}
+	return slogLogger{logger: l.logger.With(attrs...)}
+}
+
+// SlogReplaceAttr is a slog.HandlerOptions ReplaceAttr naming SlogLevelTrace TRACE.
+func SlogReplaceAttr(_ []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey {
+		if level, ok := a.Value.Any().(slog.Level); ok && level <= SlogLevelTrace {
+			a.Value = slog.StringValue("TRACE")
+		}
+	}
+	return a
+}
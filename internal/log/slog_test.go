@@ -0,0 +1,40 @@
+package log_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/angelnu/gateway-admision-controller/internal/log"
+)
+
+func TestSlog(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var out bytes.Buffer
+	logger := log.NewSlog(slog.NewJSONHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	logger.WithKV(log.KV{"pod": "test", "uid": "1234"}).WithKV(log.KV{"step": 2}).Warningf("mutating %s", "pod")
+	logger.Debugf("debug")
+	logger.Tracef("trace")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(lines, 2)
+
+	var entry map[string]interface{}
+	require.NoError(json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal("WARN", entry["level"])
+	assert.Equal("mutating pod", entry["msg"])
+	assert.Equal("test", entry["pod"])
+	assert.Equal("1234", entry["uid"])
+	assert.Equal(float64(2), entry["step"])
+
+	require.NoError(json.Unmarshal([]byte(lines[1]), &entry))
+	assert.Equal("DEBUG", entry["level"])
+}
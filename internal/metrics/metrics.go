@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const prefix = "gateway_admision_controller"
+
+// Recorder knows how to record the application metrics.
+type Recorder interface {
+	// SetTLSCertificateExpiry records when the served certificate expires.
+	SetTLSCertificateExpiry(notAfter time.Time)
+	// IncClientRejected records a request rejected by the client certificate verification.
+	IncClientRejected(reason string)
+	// IncAdmissionShed records an admission request rejected because too many were in flight.
+	IncAdmissionShed()
+	// IncFailurePolicy records the decision taken for a mutation failure of a class.
+	IncFailurePolicy(class string, decision string)
+}
+
+// Dummy recorder doesn't record anything.
+const Dummy = dummy(0)
+
+var _ Recorder = Dummy
+
+type dummy int
+
+func (dummy) SetTLSCertificateExpiry(time.Time) {}
+func (dummy) IncClientRejected(string)          {}
+func (dummy) IncAdmissionShed()                 {}
+func (dummy) IncFailurePolicy(string, string)   {}
+
+type recorder struct {
+	tlsCertificateExpiry prometheus.Gauge
+	clientRejected       *prometheus.CounterVec
+	admissionShed        prometheus.Counter
+	failurePolicy        *prometheus.CounterVec
+}
+
+// NewPrometheus returns a new metrics.Recorder for Prometheus registered on reg.
+func NewPrometheus(reg prometheus.Registerer) Recorder {
+	r := recorder{
+		tlsCertificateExpiry: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: prefix,
+			Subsystem: "tls",
+			Name:      "certificate_expiry_timestamp_seconds",
+			Help:      "The expiry time of the served TLS certificate in unix seconds.",
+		}),
+		clientRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prefix,
+			Subsystem: "tls",
+			Name:      "client_rejected_total",
+			Help:      "The number of requests rejected by the client certificate verification.",
+		}, []string{"reason"}),
+		admissionShed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: prefix,
+			Subsystem: "admission",
+			Name:      "shed_total",
+			Help:      "The number of admission requests rejected because too many were in flight.",
+		}),
+		failurePolicy: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prefix,
+			Subsystem: "admission",
+			Name:      "failure_policy_total",
+			Help:      "The number of mutation failures by class and the decision taken.",
+		}, []string{"class", "decision"}),
+	}
+
+	reg.MustRegister(
+		r.tlsCertificateExpiry,
+		r.clientRejected,
+		r.admissionShed,
+		r.failurePolicy,
+	)
+
+	return r
+}
+
+func (r recorder) SetTLSCertificateExpiry(notAfter time.Time) {
+	r.tlsCertificateExpiry.Set(float64(notAfter.Unix()))
+}
+
+func (r recorder) IncClientRejected(reason string) {
+	r.clientRejected.WithLabelValues(reason).Inc()
+}
+
+func (r recorder) IncAdmissionShed() {
+	r.admissionShed.Inc()
+}
+
+func (r recorder) IncFailurePolicy(class string, decision string) {
+	r.failurePolicy.WithLabelValues(class, decision).Inc()
+}
@@ -0,0 +1,45 @@
+package gatewayPodMutator
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// splitList splits a comma and/or whitespace separated list.
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
+
+// parseCIDRs validates a list of CIDRs and returns them in canonical form.
+func parseCIDRs(value string) ([]string, error) {
+	var cidrs []string
+	for _, entry := range splitList(value) {
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", entry, err)
+		}
+		cidrs = append(cidrs, network.String())
+	}
+	return cidrs, nil
+}
+
+// mergeCIDRs appends the additional CIDRs that are not already present.
+func mergeCIDRs(cidrs []string, additional []string) []string {
+	result := append([]string{}, cidrs...)
+	for _, cidr := range additional {
+		found := false
+		for _, existing := range result {
+			if existing == cidr {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, cidr)
+		}
+	}
+	return result
+}
@@ -0,0 +1,130 @@
+package gatewayPodMutator
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/angelnu/gateway-admision-controller/internal/config"
+)
+
+const (
+	DNS_MERGE_REPLACE       = config.DNSMergeReplace
+	DNS_MERGE_MERGE_APPEND  = config.DNSMergeAppend
+	DNS_MERGE_MERGE_PREPEND = config.DNSMergePrepend
+	DNS_MERGE_KEEP_POD      = config.DNSMergeKeepPod
+)
+
+// Kubernetes limits of the pod DNS config, the API server rejects pods above them.
+const (
+	MAX_DNS_NAMESERVERS       = 3
+	MAX_DNS_SEARCHES          = 32
+	MAX_DNS_SEARCH_LIST_CHARS = 2048
+)
+
+// dnsMergeStrategies tell how the DNS config set by the pod is merged with the gateway one.
+type dnsMergeStrategies struct {
+	nameservers string
+	searches    string
+	options     string
+}
+
+// parseDNSMergeStrategies returns the strategy of each DNS config list, replace when not set.
+func parseDNSMergeStrategies(cmdConfig config.CmdConfig) (dnsMergeStrategies, error) {
+	strategies := dnsMergeStrategies{
+		nameservers: cmdConfig.DNSMergeNameservers,
+		searches:    cmdConfig.DNSMergeSearches,
+		options:     cmdConfig.DNSMergeOptions,
+	}
+	for name, strategy := range map[string]*string{
+		"nameservers": &strategies.nameservers,
+		"searches":    &strategies.searches,
+		"options":     &strategies.options,
+	} {
+		switch *strategy {
+		case "":
+			*strategy = DNS_MERGE_REPLACE
+		case DNS_MERGE_REPLACE, DNS_MERGE_MERGE_APPEND, DNS_MERGE_MERGE_PREPEND, DNS_MERGE_KEEP_POD:
+		default:
+			return dnsMergeStrategies{}, fmt.Errorf("invalid DNS merge strategy %q for %s", *strategy, name)
+		}
+	}
+	return strategies, nil
+}
+
+// mergeEntries merges the pod and gateway entries in the order of the strategy
+// without duplicate keys, the first entry wins.
+func mergeEntries[T any](strategy string, pod []T, gateway []T, key func(T) string) []T {
+	var lists [][]T
+	switch strategy {
+	case DNS_MERGE_MERGE_APPEND:
+		lists = [][]T{pod, gateway}
+	case DNS_MERGE_MERGE_PREPEND:
+		lists = [][]T{gateway, pod}
+	case DNS_MERGE_KEEP_POD:
+		if len(pod) > 0 {
+			lists = [][]T{pod}
+		} else {
+			lists = [][]T{gateway}
+		}
+	default:
+		lists = [][]T{gateway}
+	}
+
+	var merged []T
+	seen := map[string]bool{}
+	for _, list := range lists {
+		if merged == nil && list != nil {
+			merged = make([]T, 0, len(list))
+		}
+		for _, entry := range list {
+			if !seen[key(entry)] {
+				seen[key(entry)] = true
+				merged = append(merged, entry)
+			}
+		}
+	}
+	return merged
+}
+
+func stringKey(s string) string { return s }
+
+// optionKey deduplicates the options by name, so with merge-append the pod values win
+// and with merge-prepend the gateway ones.
+func optionKey(o corev1.PodDNSConfigOption) string { return o.Name }
+
+// merge merges the DNS config of the pod, if any, with the gateway one and truncates
+// the result to the Kubernetes limits, with a warning for each truncation.
+func (s dnsMergeStrategies) merge(pod *corev1.PodDNSConfig, gateway corev1.PodDNSConfig) (corev1.PodDNSConfig, []string) {
+	if pod == nil {
+		pod = &corev1.PodDNSConfig{}
+	}
+	merged := corev1.PodDNSConfig{
+		Nameservers: mergeEntries(s.nameservers, pod.Nameservers, gateway.Nameservers, stringKey),
+		Searches:    mergeEntries(s.searches, pod.Searches, gateway.Searches, stringKey),
+		Options:     mergeEntries(s.options, pod.Options, gateway.Options, optionKey),
+	}
+
+	var warnings []string
+	if len(merged.Nameservers) > MAX_DNS_NAMESERVERS {
+		warnings = append(warnings, fmt.Sprintf("DNS nameservers %s dropped: only %d nameservers are allowed",
+			strings.Join(merged.Nameservers[MAX_DNS_NAMESERVERS:], ","), MAX_DNS_NAMESERVERS))
+		merged.Nameservers = merged.Nameservers[:MAX_DNS_NAMESERVERS]
+	}
+	if len(merged.Searches) > MAX_DNS_SEARCHES {
+		warnings = append(warnings, fmt.Sprintf("DNS searches %s dropped: only %d search domains are allowed",
+			strings.Join(merged.Searches[MAX_DNS_SEARCHES:], ","), MAX_DNS_SEARCHES))
+		merged.Searches = merged.Searches[:MAX_DNS_SEARCHES]
+	}
+	k := len(merged.Searches)
+	for k > 0 && len(strings.Join(merged.Searches[:k], " ")) > MAX_DNS_SEARCH_LIST_CHARS {
+		k--
+	}
+	if k < len(merged.Searches) {
+		warnings = append(warnings, fmt.Sprintf("DNS searches %s dropped: the search list is limited to %d characters",
+			strings.Join(merged.Searches[k:], ","), MAX_DNS_SEARCH_LIST_CHARS))
+		merged.Searches = merged.Searches[:k]
+	}
+	return merged, warnings
+}
@@ -0,0 +1,110 @@
+package gatewayPodMutator
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/angelnu/gateway-admision-controller/internal/resolv"
+)
+
+const (
+	// DNS_ANNOTATION overrides the DNS server list for a pod. Empty keeps the pod DNS, which
+	// is rejected with the None DNSPolicy
+	DNS_ANNOTATION = ANNOTATION_PREFIX + "dns"
+	// DNS_POLICY_ANNOTATION overrides the DNSPolicy for a pod
+	DNS_POLICY_ANNOTATION = ANNOTATION_PREFIX + "dns-policy"
+	// DNS_OPTIONS_ANNOTATION overrides the resolver options for a pod as comma separated name[:value].
+	// It requires a DNS server, the options are set with its DNS config
+	DNS_OPTIONS_ANNOTATION = ANNOTATION_PREFIX + "dns-options"
+)
+
+// Overrides that may be allowed with --allowed-dns-overrides, named like their annotation.
+const (
+	DNS_OVERRIDE_DNS         = "dns"
+	DNS_OVERRIDE_DNS_POLICY  = "dns-policy"
+	DNS_OVERRIDE_DNS_OPTIONS = "dns-options"
+)
+
+var dnsOverrides = []string{DNS_OVERRIDE_DNS, DNS_OVERRIDE_DNS_POLICY, DNS_OVERRIDE_DNS_OPTIONS}
+
+var dnsOverrideAnnotations = map[string]string{
+	DNS_OVERRIDE_DNS:         DNS_ANNOTATION,
+	DNS_OVERRIDE_DNS_POLICY:  DNS_POLICY_ANNOTATION,
+	DNS_OVERRIDE_DNS_OPTIONS: DNS_OPTIONS_ANNOTATION,
+}
+
+// parseAllowedDNSOverrides returns the set of overrides pods may use.
+func parseAllowedDNSOverrides(value string) (map[string]bool, error) {
+	allowed := map[string]bool{}
+	for _, override := range splitList(value) {
+		if _, ok := dnsOverrideAnnotations[override]; !ok {
+			return nil, fmt.Errorf("invalid DNS override %q: use dns, dns-policy or dns-options", override)
+		}
+		allowed[override] = true
+	}
+	return allowed, nil
+}
+
+// validateDNSPolicy fails for the policies Kubernetes does not know.
+func validateDNSPolicy(policy string) error {
+	switch corev1.DNSPolicy(policy) {
+	case corev1.DNSClusterFirst, corev1.DNSClusterFirstWithHostNet, corev1.DNSDefault, corev1.DNSNone:
+		return nil
+	}
+	return fmt.Errorf("invalid DNSPolicy %q: use ClusterFirst, ClusterFirstWithHostNet, Default or None", policy)
+}
+
+// podDNS are the DNS settings of a pod: the configured ones unless the pod overrides them.
+type podDNS struct {
+	// dns is the DNS server list, no DNS is set when empty
+	dns    string
+	policy string
+	// options replace the configured ones when set
+	options []corev1.PodDNSConfigOption
+}
+
+// podDNS returns the DNS settings of the pod. Overrides that are not allowed or not
+// valid are an error.
+func (cfg gatewayPodMutatorCfg) podDNS(pod *corev1.Pod) (podDNS, error) {
+	settings := podDNS{
+		dns:    cfg.cmdConfig.DNS,
+		policy: cfg.cmdConfig.DNSPolicy,
+	}
+
+	for _, override := range dnsOverrides {
+		annotation := dnsOverrideAnnotations[override]
+		if _, ok := pod.GetAnnotations()[annotation]; ok && !cfg.allowedDNSOverrides[override] {
+			return podDNS{}, fmt.Errorf("%s annotation in pod %s is not allowed", annotation, pod.Name)
+		}
+	}
+
+	if val, ok := pod.GetAnnotations()[DNS_ANNOTATION]; ok {
+		settings.dns = strings.Join(splitList(val), ",")
+	}
+	if val, ok := pod.GetAnnotations()[DNS_POLICY_ANNOTATION]; ok {
+		if err := validateDNSPolicy(val); err != nil {
+			return podDNS{}, fmt.Errorf("invalid %s annotation in pod %s: %w", DNS_POLICY_ANNOTATION, pod.Name, err)
+		}
+		settings.policy = val
+	}
+	if val, ok := pod.GetAnnotations()[DNS_OPTIONS_ANNOTATION]; ok {
+		settings.options = make([]corev1.PodDNSConfigOption, 0)
+		for _, option := range splitList(val) {
+			settings.options = append(settings.options, corev1.PodDNSConfigOption(resolv.ParseOption(option)))
+		}
+		// The options are only set with the DNS config of the gateway
+		if settings.dns == "" {
+			return podDNS{}, fmt.Errorf("%s annotation in pod %s requires a DNS server", DNS_OPTIONS_ANNOTATION, pod.Name)
+		}
+	}
+	// Without a DNS server a pod switched to the None DNSPolicy, or whose DNS server was
+	// removed, would get no nameservers at all
+	_, dnsOverridden := pod.GetAnnotations()[DNS_ANNOTATION]
+	_, policyOverridden := pod.GetAnnotations()[DNS_POLICY_ANNOTATION]
+	if (dnsOverridden || policyOverridden) && settings.policy == string(corev1.DNSNone) && settings.dns == "" {
+		return podDNS{}, fmt.Errorf("DNSPolicy None in pod %s requires a DNS server", pod.Name)
+	}
+	return settings, nil
+}
@@ -0,0 +1,139 @@
+package gatewayPodMutator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	kwhmodel "github.com/slok/kubewebhook/v2/pkg/model"
+	kwhmutating "github.com/slok/kubewebhook/v2/pkg/webhook/mutating"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/angelnu/gateway-admision-controller/internal/config"
+	"github.com/angelnu/gateway-admision-controller/internal/log"
+)
+
+const (
+	// FAILURE_DNS is a gateway DNS server that cannot be resolved
+	FAILURE_DNS = "dns"
+	// FAILURE_INVALID_ANNOTATION is a gateway label or annotation of the pod that cannot be parsed,
+	// or pod metadata the env and mount point templates cannot be rendered with
+	FAILURE_INVALID_ANNOTATION = "invalid-annotation"
+	// FAILURE_NAME_CONFLICT is a pod container or volume with the name of an injected one
+	FAILURE_NAME_CONFLICT = "name-conflict"
+)
+
+const (
+	FAILURE_POLICY_DENY            = config.FailurePolicyDeny
+	FAILURE_POLICY_ALLOW           = config.FailurePolicyAllow
+	FAILURE_POLICY_LAST_KNOWN_GOOD = config.FailurePolicyLastKnownGood
+)
+
+// parseFailurePolicies returns the policy of each failure class, deny when not set.
+func parseFailurePolicies(cmdConfig config.CmdConfig) (map[string]string, error) {
+	policies := map[string]string{
+		FAILURE_DNS:                cmdConfig.FailurePolicyDNS,
+		FAILURE_INVALID_ANNOTATION: cmdConfig.FailurePolicyAnnotation,
+		FAILURE_NAME_CONFLICT:      cmdConfig.FailurePolicyNameConflict,
+	}
+	for class, policy := range policies {
+		switch policy {
+		case "":
+			policies[class] = FAILURE_POLICY_DENY
+		case FAILURE_POLICY_DENY, FAILURE_POLICY_ALLOW:
+		case FAILURE_POLICY_LAST_KNOWN_GOOD:
+			// Only resolved addresses have a last known good value
+			if class != FAILURE_DNS {
+				return nil, fmt.Errorf("failure policy %q is not supported for %s failures", policy, class)
+			}
+		default:
+			return nil, fmt.Errorf("invalid failure policy %q for %s failures", policy, class)
+		}
+	}
+	return policies, nil
+}
+
+// lastKnownGood keeps the last resolved addresses. It is shared by all the copies of the mutator config.
+type lastKnownGood struct {
+	mu     sync.Mutex
+	dnsIPs []string
+}
+
+func (l *lastKnownGood) setDNSIPs(ips []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.dnsIPs = append([]string{}, ips...)
+}
+
+func (l *lastKnownGood) getDNSIPs() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.dnsIPs == nil {
+		return nil
+	}
+	return append([]string{}, l.dnsIPs...)
+}
+
+// onFailure applies the failure policy of class to err. The pod is allowed with original,
+// the pod as received, so partial mutations are dropped.
+func (cfg gatewayPodMutatorCfg) onFailure(ctx context.Context, class string, adReview *kwhmodel.AdmissionReview, original *corev1.Pod, warnings []string, err error) (*kwhmutating.MutatorResult, error) {
+	if cfg.failurePolicies[class] != FAILURE_POLICY_ALLOW {
+		cfg.audit(ctx, class, FAILURE_POLICY_DENY, adReview, original, err)
+		return nil, err
+	}
+
+	cfg.audit(ctx, class, FAILURE_POLICY_ALLOW, adReview, original, err)
+	return &kwhmutating.MutatorResult{
+		MutatedObject: original,
+		Warnings:      append(warnings, fmt.Sprintf("gateway not injected: %s", err)),
+	}, nil
+}
+
+// audit logs, counts and traces the decision taken for a failure.
+func (cfg gatewayPodMutatorCfg) audit(ctx context.Context, class string, decision string, adReview *kwhmodel.AdmissionReview, pod *corev1.Pod, err error) {
+	namespace := pod.Namespace
+	if namespace == "" && adReview != nil {
+		namespace = adReview.Namespace
+	}
+	cfg.requestLogger(ctx).WithKV(log.KV{
+		"audit":     "failure-policy",
+		"class":     class,
+		"decision":  decision,
+		"pod":       pod.Name,
+		"namespace": namespace,
+		"error":     err.Error(),
+	}).Warningf("mutation failure handled by the %s failure policy", class)
+	cfg.metrics.IncFailurePolicy(class, decision)
+	oteltrace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("gateway.failure.class", class),
+		attribute.String("gateway.failure.decision", decision),
+	)
+}
+
+// checkNameConflicts fails when the pod already has a container or volume named like an injected one.
+func (cfg gatewayPodMutatorCfg) checkNameConflicts(pod *corev1.Pod) error {
+	containers := map[string]bool{}
+	for _, container := range pod.Spec.InitContainers {
+		containers[container.Name] = true
+	}
+	for _, container := range pod.Spec.Containers {
+		containers[container.Name] = true
+	}
+
+	if cfg.cmdConfig.InitImage != "" && containers[GATEWAY_INIT_CONTAINER_NAME] {
+		return fmt.Errorf("pod %s already has a container named %s", pod.Name, GATEWAY_INIT_CONTAINER_NAME)
+	}
+	if cfg.cmdConfig.SidecarImage != "" && containers[GATEWAY_SIDECAR_CONTAINER_NAME] {
+		return fmt.Errorf("pod %s already has a container named %s", pod.Name, GATEWAY_SIDECAR_CONTAINER_NAME)
+	}
+	if cfg.cmdConfig.ConfigmapName != "" {
+		for _, volume := range pod.Spec.Volumes {
+			if volume.Name == GATEWAY_CONFIGMAP_VOLUME_NAME {
+				return fmt.Errorf("pod %s already has a volume named %s", pod.Name, GATEWAY_CONFIGMAP_VOLUME_NAME)
+			}
+		}
+	}
+	return nil
+}
@@ -2,19 +2,27 @@ package gatewayPodMutator
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"strconv"
 	"strings"
+	"text/template"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/angelnu/gateway-admision-controller/internal/resolv"
+	kwhlog "github.com/slok/kubewebhook/v2/pkg/log"
 	kwhmodel "github.com/slok/kubewebhook/v2/pkg/model"
 	kwhmutating "github.com/slok/kubewebhook/v2/pkg/webhook/mutating"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 
 	"github.com/angelnu/gateway-admision-controller/internal/config"
 	"github.com/angelnu/gateway-admision-controller/internal/log"
+	"github.com/angelnu/gateway-admision-controller/internal/metrics"
 )
 
 const (
@@ -23,6 +31,26 @@ const (
 	GATEWAY_CONFIGMAP_VOLUME_NAME  = "gateway-configmap"
 )
 
+const (
+	ANNOTATION_PREFIX = "gateway.angelnu.github.io/"
+	// BYPASS_CIDRS_ANNOTATION adds CIDRs to bypass the gateway for a pod
+	BYPASS_CIDRS_ANNOTATION = ANNOTATION_PREFIX + "bypass-cidrs"
+	// PORT_FORWARD_ANNOTATION lists the <port>[/<protocol>] to expose through the gateway
+	PORT_FORWARD_ANNOTATION = ANNOTATION_PREFIX + "port-forward"
+	// KILL_SWITCH_ANNOTATION overrides the kill switch setting for a pod
+	KILL_SWITCH_ANNOTATION = ANNOTATION_PREFIX + "kill-switch"
+	// KILL_SWITCH_ACTIVE_ANNOTATION is set by the mutator when the kill switch applies to the pod
+	KILL_SWITCH_ACTIVE_ANNOTATION = ANNOTATION_PREFIX + "kill-switch-active"
+)
+
+const (
+	SIDECAR_MODE_CONTAINER = config.SidecarModeContainer
+	SIDECAR_MODE_INIT      = config.SidecarModeInit
+	SIDECAR_MODE_AUTO      = config.SidecarModeAuto
+)
+
+const tracerName = "github.com/angelnu/gateway-admision-controller/internal/mutation"
+
 var (
 	GATEWAY_CONFIGMAP_VOLUME_MODE int32 = 0777
 )
@@ -31,66 +59,228 @@ type GatewayPodMutator interface {
 	GatewayPodMutator(ctx context.Context, _ *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhmutating.MutatorResult, error)
 }
 
+// NativeSidecarSupport tells if the cluster supports native sidecars.
+type NativeSidecarSupport interface {
+	NativeSidecarSupported() bool
+}
+
+type noNativeSidecar struct{}
+
+func (noNativeSidecar) NativeSidecarSupported() bool { return false }
+
+// Resolver resolves the gateway and DNS names, net.DefaultResolver by default.
+type Resolver interface {
+	LookupIP(ctx context.Context, network string, host string) ([]net.IP, error)
+}
+
+// Config is the mutator configuration.
+type Config struct {
+	CmdConfig config.CmdConfig
+	Logger    log.Logger
+	// NativeSidecar is used when the sidecar mode is auto.
+	NativeSidecar NativeSidecarSupport
+	Resolver      Resolver
+	Metrics       metrics.Recorder
+	// TracerProvider traces the selection and the lookups of each pod.
+	TracerProvider oteltrace.TracerProvider
+	// Status records the addresses and DNS config in use.
+	Status *Status
+}
+
+func (c *Config) defaults() error {
+
+	if c.Logger == nil {
+		c.Logger = log.Dummy
+	}
+
+	if c.NativeSidecar == nil {
+		c.NativeSidecar = noNativeSidecar{}
+	}
+
+	if c.Resolver == nil {
+		c.Resolver = net.DefaultResolver
+	}
+
+	if c.Metrics == nil {
+		c.Metrics = metrics.Dummy
+	}
+
+	if c.TracerProvider == nil {
+		c.TracerProvider = noop.NewTracerProvider()
+	}
+
+	if c.Status == nil {
+		c.Status = &Status{}
+	}
+
+	return nil
+}
+
 // NewGatewayPodMutator returns a new marker that will mark with labels.
-func NewGatewayPodMutator(cmdConfig config.CmdConfig, logger log.Logger) (GatewayPodMutator, error) {
+func NewGatewayPodMutator(config Config) (GatewayPodMutator, error) {
+	err := config.defaults()
+	if err != nil {
+		return nil, fmt.Errorf("mutator configuration is not valid: %w", err)
+	}
+	cmdConfig := config.CmdConfig
+	logger := config.Logger
+	resolverLogger := logger.WithKV(log.KV{log.ComponentKey: log.ComponentResolver})
+
+	logger.Infof("Command config is %#v", cmdConfig.Redacted())
 
-	logger.Infof("Command config is %#v", cmdConfig)
+	sidecarMode := cmdConfig.SidecarModeOrDefault()
+	switch sidecarMode {
+	case SIDECAR_MODE_CONTAINER, SIDECAR_MODE_INIT, SIDECAR_MODE_AUTO:
+	default:
+		return nil, fmt.Errorf("invalid sidecar mode %q", sidecarMode)
+	}
 
 	if cmdConfig.Gateway != "" {
 		//Check we got a valid Gateway
-		_, error := net.LookupIP(cmdConfig.Gateway)
+		gatewayIPs, error := config.Resolver.LookupIP(context.Background(), "ip", cmdConfig.Gateway)
 		if error != nil {
 			return nil, error
 		}
+		config.Status.setGateway(cmdConfig.Gateway, gatewayIPs[0].String())
 	}
 
+	lastKnown := &lastKnownGood{}
 	if cmdConfig.DNS != "" {
 		//Check we got valid DNS hosts
 		DNSServers := strings.Split(cmdConfig.DNS, ",")
+		var DNSIPs []string
 		for _, DNSServer := range DNSServers {
-			_, err := net.LookupIP(DNSServer)
+			IPs, err := config.Resolver.LookupIP(context.Background(), "ip", DNSServer)
 			if err != nil {
 				return nil, err
 			}
+			DNSIPs = append(DNSIPs, IPs[0].String())
 		}
+		config.Status.setDNS(cmdConfig.DNS, DNSIPs)
+		lastKnown.setDNSIPs(DNSIPs)
 	}
 
-	DNS_config, error := resolv.Config()
+	resolvConfPath := cmdConfig.ResolvConfPath
+	if resolvConfPath == "" {
+		resolvConfPath = resolv.DefaultPath
+	}
+	DNS_config, error := resolv.ConfigFile(resolvConfPath)
 	if error != nil {
 		return nil, error
 	}
-	logger.Infof("Current DNS config is %#v", DNS_config)
+	resolverLogger.Infof("Current DNS config is %#v", DNS_config)
 
-	podDNSConfigOptions := make([]corev1.PodDNSConfigOption, 0)
-	for i := range DNS_config.Options {
-		podDNSConfigOptions = append(podDNSConfigOptions, corev1.PodDNSConfigOption{
-			Name:  DNS_config.Options[i].Name,
-			Value: DNS_config.Options[i].Value,
-		})
+	// Explicit settings replace the ones of the webhook's own resolv.conf
+	staticDNS := DNS_config.PodDNSConfig()
+	clusterDomain := strings.Trim(cmdConfig.ClusterDomain, ".")
+	if clusterDomain != "" || cmdConfig.DNSSearch != "" {
+		staticDNS.Searches = splitList(cmdConfig.DNSSearch)
+	}
+	if cmdConfig.DNSOptions != "" {
+		staticDNS.Options = make([]corev1.PodDNSConfigOption, 0)
+		for _, option := range splitList(cmdConfig.DNSOptions) {
+			staticDNS.Options = append(staticDNS.Options, corev1.PodDNSConfigOption(resolv.ParseOption(option)))
+		}
+	}
+	config.Status.setStaticDNS(staticDNS)
+
+	envTemplates, err := parseEnvTemplates(cmdConfig.Env)
+	if err != nil {
+		return nil, err
+	}
+	initMountPoint, err := parseTemplate("initMountPoint", cmdConfig.InitMountPoint)
+	if err != nil {
+		return nil, err
+	}
+	sidecarMountPoint, err := parseTemplate("sidecarMountPoint", cmdConfig.SidecarMountPoint)
+	if err != nil {
+		return nil, err
+	}
+	initContainerPosition, err := parseContainerPosition(cmdConfig.InitContainerPosition)
+	if err != nil {
+		return nil, err
+	}
+	bypassCIDRs, err := parseCIDRs(cmdConfig.BypassCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bypass-cidrs: %w", err)
+	}
+	portForwardRange, err := parsePortRange(cmdConfig.PortForwardRange)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port-forward-range: %w", err)
+	}
+	killSwitchAllowedCIDRs, err := parseCIDRs(cmdConfig.KillSwitchAllowedCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kill-switch-allowed-cidrs: %w", err)
+	}
+	failurePolicies, err := parseFailurePolicies(cmdConfig)
+	if err != nil {
+		return nil, err
+	}
+	dnsMerge, err := parseDNSMergeStrategies(cmdConfig)
+	if err != nil {
+		return nil, err
+	}
+	if cmdConfig.DNSPolicy != "" {
+		if err := validateDNSPolicy(cmdConfig.DNSPolicy); err != nil {
+			return nil, err
+		}
+	}
+	allowedDNSOverrides, err := parseAllowedDNSOverrides(cmdConfig.AllowedDNSOverrides)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allowed-dns-overrides: %w", err)
+	}
+	killSwitchRequiredNamespaces := map[string]bool{}
+	for _, namespace := range splitList(cmdConfig.KillSwitchRequiredNs) {
+		killSwitchRequiredNamespaces[namespace] = true
 	}
 
 	return gatewayPodMutatorCfg{
-		cmdConfig: cmdConfig,
-		staticDNS: corev1.PodDNSConfig{
-			Nameservers: DNS_config.Nameservers,
-			Searches:    DNS_config.Search,
-			Options:     podDNSConfigOptions,
-		},
-		logger: logger,
+		cmdConfig:             cmdConfig,
+		staticDNS:             staticDNS,
+		clusterDomain:         clusterDomain,
+		dnsMerge:              dnsMerge,
+		allowedDNSOverrides:   allowedDNSOverrides,
+		envTemplates:          envTemplates,
+		initMountPoint:        initMountPoint,
+		sidecarMountPoint:     sidecarMountPoint,
+		initContainerPosition: initContainerPosition,
+		sidecarMode:           sidecarMode,
+		nativeSidecar:         config.NativeSidecar,
+		bypassCIDRs:           bypassCIDRs,
+		portForwardRange:      portForwardRange,
+
+		killSwitchAllowedCIDRs:       killSwitchAllowedCIDRs,
+		killSwitchRequiredNamespaces: killSwitchRequiredNamespaces,
+		failurePolicies:              failurePolicies,
+		lastKnown:                    lastKnown,
+		status:                       config.Status,
+		resolver:                     config.Resolver,
+		tracer:                       config.TracerProvider.Tracer(tracerName),
+		logger:                       logger,
+		metrics:                      config.Metrics,
 	}, nil
 }
 
-func (cfg gatewayPodMutatorCfg) getGatewayIP() (string, error) {
-	getGatewayIPs, error := net.LookupIP(cfg.cmdConfig.Gateway)
-	return getGatewayIPs[0].String(), error
+func (cfg gatewayPodMutatorCfg) getGatewayIP(ctx context.Context) (string, error) {
+	getGatewayIPs, error := cfg.resolver.LookupIP(ctx, "ip", cfg.cmdConfig.Gateway)
+	if error != nil {
+		return "", error
+	}
+	cfg.status.setGateway(cfg.cmdConfig.Gateway, getGatewayIPs[0].String())
+	return getGatewayIPs[0].String(), nil
 }
 
-func (cfg gatewayPodMutatorCfg) getDNSIPs() ([]string, error) {
+func (cfg gatewayPodMutatorCfg) getDNSIPs(ctx context.Context, dns string) ([]string, error) {
+	ctx, span := cfg.tracer.Start(ctx, "dns.resolve", oteltrace.WithAttributes(attribute.String("gateway.dns", dns)))
+	defer span.End()
+
 	var resolvedIPs []string
-	DNSServers := strings.Split(cfg.cmdConfig.DNS, ",")
+	DNSServers := strings.Split(dns, ",")
 	for _, DNSServer := range DNSServers {
-		resolvedServerIPs, error := net.LookupIP(DNSServer)
+		resolvedServerIPs, error := cfg.resolver.LookupIP(ctx, "ip", DNSServer)
 		if error != nil {
+			span.RecordError(error)
+			span.SetStatus(codes.Error, error.Error())
 			return nil, error
 		}
 		resolvedIPs = append(resolvedIPs, resolvedServerIPs[0].String())
@@ -99,19 +289,62 @@ func (cfg gatewayPodMutatorCfg) getDNSIPs() ([]string, error) {
 }
 
 type gatewayPodMutatorCfg struct {
-	cmdConfig config.CmdConfig
-	staticDNS corev1.PodDNSConfig
-	logger    log.Logger
+	cmdConfig             config.CmdConfig
+	staticDNS             corev1.PodDNSConfig
+	clusterDomain         string
+	dnsMerge              dnsMergeStrategies
+	allowedDNSOverrides   map[string]bool
+	envTemplates          []envTemplate
+	initMountPoint        *template.Template
+	sidecarMountPoint     *template.Template
+	initContainerPosition containerPosition
+	sidecarMode           string
+	nativeSidecar         NativeSidecarSupport
+	bypassCIDRs           []string
+	portForwardRange      *portRange
+
+	killSwitchAllowedCIDRs       []string
+	killSwitchRequiredNamespaces map[string]bool
+
+	// failurePolicies by failure class
+	failurePolicies map[string]string
+	lastKnown       *lastKnownGood
+	status          *Status
+	resolver        Resolver
+	tracer          oteltrace.Tracer
+
+	logger  log.Logger
+	metrics metrics.Recorder
 }
 
-func (cfg gatewayPodMutatorCfg) GatewayPodMutator(_ context.Context, adReview *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhmutating.MutatorResult, error) {
+// useNativeSidecar tells if the sidecar should be injected as an init container with RestartPolicy Always.
+func (cfg gatewayPodMutatorCfg) useNativeSidecar() bool {
+	switch cfg.sidecarMode {
+	case SIDECAR_MODE_INIT:
+		return true
+	case SIDECAR_MODE_AUTO:
+		return cfg.nativeSidecar.NativeSidecarSupported()
+	}
+	return false
+}
 
-	pod, ok := obj.(*corev1.Pod)
-	if !ok {
-		// If not a pod just continue the mutation chain(if there is one) and don't do nothing.
-		return &kwhmutating.MutatorResult{}, nil
+// isJobPod tells if the pod is run by a Job, including the ones created by a CronJob.
+func isJobPod(pod *corev1.Pod) bool {
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind == "Job" {
+			return true
+		}
 	}
+	for _, label := range []string{"batch.kubernetes.io/job-name", "job-name"} {
+		if _, ok := pod.Labels[label]; ok {
+			return true
+		}
+	}
+	return false
+}
 
+// selectPod tells if the gateway must be set for the pod.
+func (cfg gatewayPodMutatorCfg) selectPod(pod *corev1.Pod) (bool, error) {
 	setGateway := cfg.cmdConfig.SetGatewayDefault
 	var err error
 
@@ -135,7 +368,7 @@ func (cfg gatewayPodMutatorCfg) GatewayPodMutator(_ context.Context, adReview *k
 
 			setGateway, err = strconv.ParseBool(val)
 			if err != nil {
-				return nil, err
+				return false, err
 			}
 		}
 	}
@@ -154,20 +387,93 @@ func (cfg gatewayPodMutatorCfg) GatewayPodMutator(_ context.Context, adReview *k
 
 			setGateway, err = strconv.ParseBool(val)
 			if err != nil {
-				return nil, err
+				return false, err
 			}
 		}
 	}
 
+	return setGateway, nil
+}
+
+func (cfg gatewayPodMutatorCfg) GatewayPodMutator(ctx context.Context, adReview *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhmutating.MutatorResult, error) {
+	ctx, span := cfg.tracer.Start(ctx, "GatewayPodMutator")
+	defer span.End()
+	if adReview != nil {
+		span.SetAttributes(
+			attribute.String("admission.uid", adReview.ID),
+			attribute.String("k8s.namespace.name", adReview.Namespace),
+		)
+	}
+
+	res, err := cfg.mutate(ctx, adReview, obj)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return res, err
+}
+
+// requestLogger returns the logger with the admission values (request-id, op, ns...) that
+// Kubewebhook sets on the context, like its WithCtxValues, so the mutation log lines can be
+// correlated with the API server audit log.
+func (cfg gatewayPodMutatorCfg) requestLogger(ctx context.Context) log.Logger {
+	return cfg.logger.WithKV(kwhlog.ValuesFromCtx(ctx))
+}
+
+func (cfg gatewayPodMutatorCfg) mutate(ctx context.Context, adReview *kwhmodel.AdmissionReview, obj metav1.Object) (*kwhmutating.MutatorResult, error) {
+	logger := cfg.requestLogger(ctx)
+	// The DNS resolution logs with its own level
+	resolverLogger := logger.WithKV(log.KV{log.ComponentKey: log.ComponentResolver})
+
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		// If not a pod just continue the mutation chain(if there is one) and don't do nothing.
+		return &kwhmutating.MutatorResult{}, nil
+	}
+
+	// The pod as received, admitted when a failure policy allows it unmutated
+	original := pod.DeepCopy()
+
+	var warnings []string
+	var err error
+
+	_, selectSpan := cfg.tracer.Start(ctx, "selection")
+	setGateway, err := cfg.selectPod(pod)
+	selectSpan.SetAttributes(attribute.Bool("gateway.selected", setGateway))
+	selectSpan.End()
+	if err != nil {
+		return cfg.onFailure(ctx, FAILURE_INVALID_ANNOTATION, adReview, original, warnings, err)
+	}
+
 	if setGateway {
 
+		if err := cfg.checkNameConflicts(pod); err != nil {
+			return cfg.onFailure(ctx, FAILURE_NAME_CONFLICT, adReview, original, warnings, err)
+		}
+
+		dnsSettings, err := cfg.podDNS(pod)
+		if err != nil {
+			return cfg.onFailure(ctx, FAILURE_INVALID_ANNOTATION, adReview, original, warnings, err)
+		}
+		// The last known addresses are only kept for the configured DNS
+		configuredDNS := dnsSettings.dns == cfg.cmdConfig.DNS
+
 		var error error
 		var DNS_IPs []string
-		if cfg.cmdConfig.DNS != "" {
+		if dnsSettings.dns != "" {
 			//Add DNS
-			DNS_IPs, error = cfg.getDNSIPs()
-			if error != nil {
-				return nil, error
+			DNS_IPs, error = cfg.getDNSIPs(ctx, dnsSettings.dns)
+			if error == nil {
+				if configuredDNS {
+					cfg.lastKnown.setDNSIPs(DNS_IPs)
+					cfg.status.setDNS(dnsSettings.dns, DNS_IPs)
+				}
+			} else if lastKnown := cfg.lastKnown.getDNSIPs(); cfg.failurePolicies[FAILURE_DNS] == FAILURE_POLICY_LAST_KNOWN_GOOD && configuredDNS && lastKnown != nil {
+				cfg.audit(ctx, FAILURE_DNS, FAILURE_POLICY_LAST_KNOWN_GOOD, adReview, pod, error)
+				warnings = append(warnings, fmt.Sprintf("DNS could not be resolved, using the last known addresses %s", strings.Join(lastKnown, ",")))
+				DNS_IPs = lastKnown
+			} else {
+				return cfg.onFailure(ctx, FAILURE_DNS, adReview, original, warnings, error)
 			}
 
 			pod.Spec.DNSConfig = &corev1.PodDNSConfig{
@@ -176,27 +482,27 @@ func (cfg gatewayPodMutatorCfg) GatewayPodMutator(_ context.Context, adReview *k
 				// Options:  []corev1.PodDNSConfigOption{},
 			}
 
-			if cfg.cmdConfig.DNSPolicy == "None" {
+			if dnsSettings.policy == "None" {
 				// Copy my own webhook settings
 				copied := cfg.staticDNS.DeepCopy()
 
 				//fix the first search to match the pod namespace
 				for i := range copied.Searches {
-					cfg.logger.Debugf("DNS search entry BEFORE: %s", copied.Searches[i])
+					resolverLogger.Debugf("DNS search entry BEFORE: %s", copied.Searches[i])
 					searchParts := strings.Split(copied.Searches[i], ".")
 					if len(searchParts) > 2 && searchParts[1] == "svc" {
 						if pod.Namespace != "" {
 							searchParts[0] = pod.Namespace
-							cfg.logger.Infof("Corrected namespace in search to POD namespace")
+							resolverLogger.Infof("Corrected namespace in search to POD namespace")
 						} else if adReview.Namespace != "" {
 							searchParts[0] = adReview.Namespace
-							cfg.logger.Infof("Corrected namespace in search to adReview namespace")
+							resolverLogger.Infof("Corrected namespace in search to adReview namespace")
 						} else {
-							cfg.logger.Warningf("Empty namespace - not changing search domainss")
+							resolverLogger.Warningf("Empty namespace - not changing search domainss")
 						}
 						copied.Searches[i] = strings.Join(searchParts, ".")
 					}
-					cfg.logger.Debugf("DNS search entry AFTER: %s", copied.Searches[i])
+					resolverLogger.Debugf("DNS search entry AFTER: %s", copied.Searches[i])
 				}
 
 				k := 0
@@ -211,30 +517,173 @@ func (cfg gatewayPodMutatorCfg) GatewayPodMutator(_ context.Context, adReview *k
 					}
 				}
 				copied.Searches = copied.Searches[:k]
-				cfg.logger.Debugf("DNS searches: %v", copied.Searches)
+
+				if cfg.clusterDomain != "" {
+					// Build the cluster searches instead of relying on the webhook's own
+					clusterSearches := []string{"svc." + cfg.clusterDomain, cfg.clusterDomain}
+					namespace := pod.Namespace
+					if namespace == "" && adReview != nil {
+						namespace = adReview.Namespace
+					}
+					if namespace != "" {
+						clusterSearches = append([]string{namespace + ".svc." + cfg.clusterDomain}, clusterSearches...)
+					} else {
+						resolverLogger.Warningf("Empty namespace - not adding the namespace search domain")
+					}
+					copied.Searches = append(clusterSearches, copied.Searches...)
+				}
+				resolverLogger.Debugf("DNS searches: %v", copied.Searches)
 
 				pod.Spec.DNSConfig.Searches = copied.Searches
 				pod.Spec.DNSConfig.Options = copied.Options
 			}
+			if dnsSettings.options != nil {
+				pod.Spec.DNSConfig.Options = dnsSettings.options
+			}
+
+			// Keep what the workload set on purpose
+			merged, mergeWarnings := cfg.dnsMerge.merge(original.Spec.DNSConfig, *pod.Spec.DNSConfig)
+			for _, warning := range mergeWarnings {
+				resolverLogger.Warningf("%s", warning)
+			}
+			warnings = append(warnings, mergeWarnings...)
+			pod.Spec.DNSConfig = &merged
 		}
 
 		k8s_DNS_ips := strings.Join(cfg.staticDNS.Nameservers, " ")
 
-		if cfg.cmdConfig.DNSPolicy != "" {
+		if dnsSettings.policy != "" {
 			//Add DNSPolicy
-			pod.Spec.DNSPolicy = corev1.DNSPolicy(cfg.cmdConfig.DNSPolicy)
+			pod.Spec.DNSPolicy = corev1.DNSPolicy(dnsSettings.policy)
+		}
+
+		// Data for the env and mount point templates
+		data := templateData{
+			Pod:       pod.ObjectMeta,
+			Namespace: pod.Namespace,
+			Gateway:   cfg.cmdConfig.Gateway,
+			DNS:       dnsSettings.dns,
+			DNSIPs:    DNS_IPs,
+			K8sDNSIPs: cfg.staticDNS.Nameservers,
+			dnsConfig: pod.Spec.DNSConfig,
+			cfg:       cfg,
+			ctx:       ctx,
+		}
+		if adReview != nil && adReview.Namespace != "" {
+			data.Namespace = adReview.Namespace
+		}
+
+		env := []corev1.EnvVar{
+			{
+				Name:  "gateway",
+				Value: cfg.cmdConfig.Gateway,
+			},
+			{
+				Name:  "DNS",
+				Value: dnsSettings.dns,
+			},
+			{
+				Name:  "DNS_ips",
+				Value: strings.Join(DNS_IPs, ","),
+			},
+			{
+				Name:  "K8S_DNS_ips",
+				Value: k8s_DNS_ips,
+			},
+		}
+
+		// Networks that must not be routed through the gateway
+		bypassCIDRs := cfg.bypassCIDRs
+		if val, ok := pod.GetAnnotations()[BYPASS_CIDRS_ANNOTATION]; ok {
+			podCIDRs, err := parseCIDRs(val)
+			if err != nil {
+				return cfg.onFailure(ctx, FAILURE_INVALID_ANNOTATION, adReview, original, warnings,
+					fmt.Errorf("invalid %s annotation in pod %s: %w", BYPASS_CIDRS_ANNOTATION, pod.Name, err))
+			}
+			bypassCIDRs = mergeCIDRs(bypassCIDRs, podCIDRs)
+		}
+		if len(bypassCIDRs) > 0 {
+			env = append(env, corev1.EnvVar{
+				Name:  "BYPASS_CIDRS",
+				Value: strings.Join(bypassCIDRs, " "),
+			})
+		}
+
+		// Kill switch: block traffic outside the gateway when the tunnel is down
+		killSwitch := cfg.cmdConfig.KillSwitch
+		if val, ok := pod.GetAnnotations()[KILL_SWITCH_ANNOTATION]; ok {
+			killSwitch, err = strconv.ParseBool(val)
+			if err != nil {
+				return cfg.onFailure(ctx, FAILURE_INVALID_ANNOTATION, adReview, original, warnings,
+					fmt.Errorf("invalid %s annotation in pod %s: %w", KILL_SWITCH_ANNOTATION, pod.Name, err))
+			}
+			if !killSwitch && cfg.killSwitchRequiredNamespaces[data.Namespace] {
+				warnings = append(warnings, fmt.Sprintf("kill switch is required in namespace %s and cannot be disabled", data.Namespace))
+			}
+		}
+		if cfg.killSwitchRequiredNamespaces[data.Namespace] {
+			killSwitch = true
+		}
+		if killSwitch {
+			env = append(env,
+				corev1.EnvVar{
+					Name:  "KILL_SWITCH",
+					Value: "true",
+				},
+				corev1.EnvVar{
+					Name:  "KILL_SWITCH_ALLOWED_CIDRS",
+					Value: strings.Join(mergeCIDRs(cfg.killSwitchAllowedCIDRs, bypassCIDRs), " "),
+				},
+			)
+
+			if pod.Annotations == nil {
+				pod.Annotations = map[string]string{}
+			}
+			pod.Annotations[KILL_SWITCH_ACTIVE_ANNOTATION] = "true"
 		}
 
+		extraEnv, err := renderEnv(cfg.envTemplates, data)
+		if err != nil {
+			return cfg.onFailure(ctx, FAILURE_INVALID_ANNOTATION, adReview, original, warnings,
+				fmt.Errorf("could not template env for pod %s: %w", pod.Name, err))
+		}
+		env = append(env, extraEnv...)
+
+		// Ports to expose through the gateway, only known by the sidecar
+		var sidecarEnv []corev1.EnvVar
+		if val, ok := pod.GetAnnotations()[PORT_FORWARD_ANNOTATION]; ok {
+			if cfg.cmdConfig.SidecarImage == "" {
+				return cfg.onFailure(ctx, FAILURE_INVALID_ANNOTATION, adReview, original, warnings,
+					fmt.Errorf("invalid %s annotation in pod %s: port forwarding requires the sidecar", PORT_FORWARD_ANNOTATION, pod.Name))
+			}
+			forwards, err := parsePortForwards(val, cfg.portForwardRange)
+			if err != nil {
+				return cfg.onFailure(ctx, FAILURE_INVALID_ANNOTATION, adReview, original, warnings,
+					fmt.Errorf("invalid %s annotation in pod %s: %w", PORT_FORWARD_ANNOTATION, pod.Name, err))
+			}
+			sidecarEnv = portForwardEnv(forwards)
+		}
+
+		// Injected init containers are inserted together so the native sidecar
+		// is always running before any init container that needs the gateway
+		var initContainers []corev1.Container
+
 		if cfg.cmdConfig.InitImage != "" {
 
+			mountPoint, err := renderTemplate(cfg.initMountPoint, data)
+			if err != nil {
+				return cfg.onFailure(ctx, FAILURE_INVALID_ANNOTATION, adReview, original, warnings,
+					fmt.Errorf("could not template mount point for pod %s: %w", pod.Name, err))
+			}
+
 			var volumeMount []corev1.VolumeMount
-			if cfg.cmdConfig.InitMountPoint != "" {
+			if mountPoint != "" {
 				// Create volume mount
 				volumeMount = []corev1.VolumeMount{
 					corev1.VolumeMount{
 						Name:      GATEWAY_CONFIGMAP_VOLUME_NAME,
 						ReadOnly:  true,
-						MountPath: cfg.cmdConfig.InitMountPoint,
+						MountPath: mountPoint,
 						// SubPath:          "",
 						// MountPropagation: &"",
 						// SubPathExpr:      "",
@@ -253,24 +702,7 @@ func (cfg gatewayPodMutatorCfg) GatewayPodMutator(_ context.Context, adReview *k
 				// WorkingDir:               "",
 				// Ports:                    []corev1.ContainerPort{},
 				// EnvFrom:                  []corev1.EnvFromSource{},
-				Env: []corev1.EnvVar{
-					{
-						Name:  "gateway",
-						Value: cfg.cmdConfig.Gateway,
-					},
-					{
-						Name:  "DNS",
-						Value: cfg.cmdConfig.DNS,
-					},
-					{
-						Name:  "DNS_ips",
-						Value: strings.Join(DNS_IPs, ","),
-					},
-					{
-						Name:  "K8S_DNS_ips",
-						Value: k8s_DNS_ips,
-					},
-				},
+				Env: env,
 				// Resources:                corev1.ResourceRequirements{},
 				VolumeMounts: volumeMount,
 				// VolumeDevices:            []corev1.VolumeDevice{},
@@ -298,19 +730,25 @@ func (cfg gatewayPodMutatorCfg) GatewayPodMutator(_ context.Context, adReview *k
 			}
 
 			//Add  initContainer to pod
-			pod.Spec.InitContainers = append(pod.Spec.InitContainers, container)
+			initContainers = append(initContainers, container)
 		}
 
 		if cfg.cmdConfig.SidecarImage != "" {
 
+			mountPoint, err := renderTemplate(cfg.sidecarMountPoint, data)
+			if err != nil {
+				return cfg.onFailure(ctx, FAILURE_INVALID_ANNOTATION, adReview, original, warnings,
+					fmt.Errorf("could not template mount point for pod %s: %w", pod.Name, err))
+			}
+
 			var volumeMount []corev1.VolumeMount
-			if cfg.cmdConfig.SidecarMountPoint != "" {
+			if mountPoint != "" {
 				// Create volume mount
 				volumeMount = []corev1.VolumeMount{
 					corev1.VolumeMount{
 						Name:      GATEWAY_CONFIGMAP_VOLUME_NAME,
 						ReadOnly:  true,
-						MountPath: cfg.cmdConfig.SidecarMountPoint,
+						MountPath: mountPoint,
 						// SubPath:          "",
 						// MountPropagation: &"",
 						// SubPathExpr:      "",
@@ -329,24 +767,7 @@ func (cfg gatewayPodMutatorCfg) GatewayPodMutator(_ context.Context, adReview *k
 				// WorkingDir:               "",
 				// Ports:                    []corev1.ContainerPort{},
 				// EnvFrom:                  []corev1.EnvFromSource{},
-				Env: []corev1.EnvVar{
-					{
-						Name:  "gateway",
-						Value: cfg.cmdConfig.Gateway,
-					},
-					{
-						Name:  "DNS",
-						Value: cfg.cmdConfig.DNS,
-					},
-					{
-						Name:  "DNS_ips",
-						Value: strings.Join(DNS_IPs, ","),
-					},
-					{
-						Name:  "K8S_DNS_ips",
-						Value: k8s_DNS_ips,
-					},
-				},
+				Env: append(append([]corev1.EnvVar{}, env...), sidecarEnv...),
 				// Resources:                corev1.ResourceRequirements{},
 				VolumeMounts: volumeMount,
 				// VolumeDevices:            []corev1.VolumeDevice{},
@@ -374,13 +795,27 @@ func (cfg gatewayPodMutatorCfg) GatewayPodMutator(_ context.Context, adReview *k
 			}
 
 			//Add container to pod
-			if cfg.cmdConfig.SidecarAsInit {
+			if cfg.useNativeSidecar() {
 				rs := corev1.ContainerRestartPolicyAlways
 				container.RestartPolicy = &rs
 
-				pod.Spec.InitContainers = append(pod.Spec.InitContainers, container)
+				initContainers = append(initContainers, container)
 			} else {
 				pod.Spec.Containers = append(pod.Spec.Containers, container)
+
+				if isJobPod(pod) {
+					// A regular sidecar keeps running after the job containers complete
+					warnings = append(warnings, "gateway sidecar injected as a regular container: the Job will not complete while it runs. Native sidecars require Kubernetes v1.29")
+				}
+			}
+		}
+
+		if len(initContainers) > 0 {
+			var found bool
+			pod.Spec.InitContainers, found = cfg.initContainerPosition.insert(pod.Spec.InitContainers, initContainers)
+			if !found {
+				logger.Warningf("Init container %s not found in pod %s - appending gateway init containers",
+					cfg.initContainerPosition.container, pod.Name)
 			}
 		}
 
@@ -399,11 +834,18 @@ func (cfg gatewayPodMutatorCfg) GatewayPodMutator(_ context.Context, adReview *k
 		}
 	}
 
-	cfg.logger.Infof("Mutated pod %s", pod.Name)
-	cfg.logger.Debugf("%s", pod.String())
+	decision := "skip"
+	if setGateway {
+		decision = "inject"
+	}
+	oteltrace.SpanFromContext(ctx).SetAttributes(attribute.String("gateway.decision", decision))
+
+	logger.Infof("Mutated pod %s", pod.Name)
+	logger.Tracef("%s", pod.String())
 
 	return &kwhmutating.MutatorResult{
 		MutatedObject: pod,
+		Warnings:      warnings,
 	}, nil
 
 }
@@ -2,18 +2,27 @@ package gatewayPodMutator_test
 
 import (
 	"context"
+	"fmt"
 	"net"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/sirupsen/logrus"
+	kwhlog "github.com/slok/kubewebhook/v2/pkg/log"
+	kwhmodel "github.com/slok/kubewebhook/v2/pkg/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/angelnu/gateway-admision-controller/internal/config"
 	"github.com/angelnu/gateway-admision-controller/internal/log"
+	"github.com/angelnu/gateway-admision-controller/internal/log/logtest"
 	mutator "github.com/angelnu/gateway-admision-controller/internal/mutation"
 	"github.com/angelnu/gateway-admision-controller/internal/resolv"
 )
@@ -635,7 +644,10 @@ func TestGatewayPodMutator(t *testing.T) {
 			assert := assert.New(t)
 			require := require.New(t)
 
-			m, err := mutator.NewGatewayPodMutator(test.cmdConfig, log.NewLogrus(logrusLogEntry).WithKV(log.KV{"test": name}))
+			m, err := mutator.NewGatewayPodMutator(mutator.Config{
+				CmdConfig: test.cmdConfig,
+				Logger:    log.NewLogrus(logrusLogEntry).WithKV(log.KV{"test": name}),
+			})
 			require.NoError(err)
 
 			_, err = m.GatewayPodMutator(context.TODO(), nil, test.obj)
@@ -690,6 +702,33 @@ func TestGatewayPodMutatorReturnsError(t *testing.T) {
 				},
 			},
 		},
+		"env template - it should return error as the label is missing": {
+			cmdConfig: config.CmdConfig{
+				Gateway:           testGatewayIP,
+				SetGatewayDefault: true,
+				InitImage:         testInitImage,
+				InitCmd:           testInitCmd,
+				Env: map[string]string{
+					"VPN_TABLE": "{{ .Pod.Labels.table }}",
+				},
+			},
+			obj: &corev1.Pod{},
+		},
+		"bypass CIDRs annotation - it should return error as the CIDR is invalid": {
+			cmdConfig: config.CmdConfig{
+				Gateway:           testGatewayIP,
+				SetGatewayDefault: true,
+				InitImage:         testInitImage,
+				InitCmd:           testInitCmd,
+			},
+			obj: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						mutator.BYPASS_CIDRS_ANNOTATION: "192.168.1.0/33",
+					},
+				},
+			},
+		},
 	}
 
 	logrusLog := logrus.New()
@@ -700,7 +739,10 @@ func TestGatewayPodMutatorReturnsError(t *testing.T) {
 			assert := assert.New(t)
 			require := require.New(t)
 
-			m, err := mutator.NewGatewayPodMutator(test.cmdConfig, log.NewLogrus(logrusLogEntry).WithKV(log.KV{"test": name}))
+			m, err := mutator.NewGatewayPodMutator(mutator.Config{
+				CmdConfig: test.cmdConfig,
+				Logger:    log.NewLogrus(logrusLogEntry).WithKV(log.KV{"test": name}),
+			})
 			require.NoError(err)
 
 			_, err = m.GatewayPodMutator(context.TODO(), nil, test.obj)
@@ -708,3 +750,1262 @@ func TestGatewayPodMutatorReturnsError(t *testing.T) {
 		})
 	}
 }
+
+func TestGatewayPodMutatorTemplates(t *testing.T) {
+
+	tests := map[string]struct {
+		cmdConfig    config.CmdConfig
+		obj          *corev1.Pod
+		expEnv       []corev1.EnvVar
+		expMountPath string
+	}{
+		"env from pod metadata and admission data": {
+			cmdConfig: config.CmdConfig{
+				SetGatewayDefault: true,
+				Gateway:           testGatewayIP,
+				DNS:               testDNSIP,
+				InitImage:         testInitImage,
+				InitCmd:           testInitCmd,
+				InitMountPoint:    "/config/{{ .Namespace }}",
+				ConfigmapName:     testConfigmapName,
+				Env: map[string]string{
+					"VPN_TABLE":  "vpn-{{ .Namespace }}",
+					"PORTS":      `{{ index .Pod.Annotations "ports" | default "none" }}`,
+					"GATEWAY_IP": "{{ .GatewayIP }}",
+					"DNS_LIST":   `{{ join .DNSIPs ";" }}`,
+				},
+			},
+			obj: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: testNamespace,
+					Annotations: map[string]string{
+						"ports": "6881",
+					},
+				},
+			},
+			expEnv: []corev1.EnvVar{
+				{Name: "DNS_LIST", Value: "5.6.7.8;9.10.11.12"},
+				{Name: "GATEWAY_IP", Value: testGatewayIP},
+				{Name: "PORTS", Value: "6881"},
+				{Name: "VPN_TABLE", Value: "vpn-" + testNamespace},
+			},
+			expMountPath: "/config/" + testNamespace,
+		},
+		"default value when annotation is missing": {
+			cmdConfig: config.CmdConfig{
+				SetGatewayDefault: true,
+				Gateway:           testGatewayIP,
+				InitImage:         testInitImage,
+				InitCmd:           testInitCmd,
+				Env: map[string]string{
+					"PORTS": `{{ index .Pod.Annotations "ports" | default "none" }}`,
+				},
+			},
+			obj: &corev1.Pod{},
+			expEnv: []corev1.EnvVar{
+				{Name: "PORTS", Value: "none"},
+			},
+		},
+		"resolv.conf of the pod DNS config": {
+			cmdConfig: config.CmdConfig{
+				SetGatewayDefault: true,
+				Gateway:           testGatewayIP,
+				DNS:               testDNSIP,
+				InitImage:         testInitImage,
+				Env: map[string]string{
+					"RESOLV_CONF": "{{ .ResolvConf }}",
+				},
+			},
+			obj: &corev1.Pod{},
+			expEnv: []corev1.EnvVar{
+				{Name: "RESOLV_CONF", Value: "nameserver 5.6.7.8\nnameserver 9.10.11.12\n"},
+			},
+		},
+	}
+
+	logrusLog := logrus.New()
+	logrusLogEntry := logrus.NewEntry(logrusLog).WithField("app", "gatewayPodMutator Test for templates")
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			m, err := mutator.NewGatewayPodMutator(mutator.Config{
+				CmdConfig: test.cmdConfig,
+				Logger:    log.NewLogrus(logrusLogEntry).WithKV(log.KV{"test": name}),
+			})
+			require.NoError(err)
+
+			_, err = m.GatewayPodMutator(context.TODO(), nil, test.obj)
+			require.NoError(err)
+
+			require.Len(test.obj.Spec.InitContainers, 1)
+			container := test.obj.Spec.InitContainers[0]
+			// The first env are always gateway, DNS, DNS_ips and K8S_DNS_ips
+			assert.Equal(test.expEnv, container.Env[4:])
+			if test.expMountPath != "" {
+				require.Len(container.VolumeMounts, 1)
+				assert.Equal(test.expMountPath, container.VolumeMounts[0].MountPath)
+			}
+		})
+	}
+}
+
+func TestNewGatewayPodMutatorReturnsError(t *testing.T) {
+	tests := map[string]config.CmdConfig{
+		"unparsable env template": {
+			Env: map[string]string{"VPN_TABLE": "{{ .Namespace "},
+		},
+		"reserved env name": {
+			Env: map[string]string{"gateway": "1.2.3.4"},
+		},
+		"unparsable mount point template": {
+			SidecarMountPoint: "/mnt/{{ end }}",
+		},
+		"invalid init container position": {
+			InitContainerPosition: "middle",
+		},
+		"init container position without container": {
+			InitContainerPosition: "before:",
+		},
+		"invalid sidecar mode": {
+			SidecarMode: "sometimes",
+		},
+		"invalid bypass CIDR": {
+			BypassCIDRs: "10.0.0.0/8,10.43.0.0",
+		},
+		"invalid port forward range": {
+			PortForwardRange: "2000-1000",
+		},
+		"invalid kill switch allowed CIDR": {
+			KillSwitchAllowedCIDRs: "192.168.0.0/16,lan",
+		},
+	}
+
+	for name, cmdConfig := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := mutator.NewGatewayPodMutator(mutator.Config{CmdConfig: cmdConfig})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestGatewayPodMutatorInitContainerPosition(t *testing.T) {
+
+	tests := map[string]struct {
+		position string
+		expNames []string
+	}{
+		"default": {
+			position: "",
+			expNames: []string{"download", "setup", mutator.GATEWAY_INIT_CONTAINER_NAME, mutator.GATEWAY_SIDECAR_CONTAINER_NAME},
+		},
+		"first": {
+			position: "first",
+			expNames: []string{mutator.GATEWAY_INIT_CONTAINER_NAME, mutator.GATEWAY_SIDECAR_CONTAINER_NAME, "download", "setup"},
+		},
+		"last": {
+			position: "last",
+			expNames: []string{"download", "setup", mutator.GATEWAY_INIT_CONTAINER_NAME, mutator.GATEWAY_SIDECAR_CONTAINER_NAME},
+		},
+		"before setup": {
+			position: "before:setup",
+			expNames: []string{"download", mutator.GATEWAY_INIT_CONTAINER_NAME, mutator.GATEWAY_SIDECAR_CONTAINER_NAME, "setup"},
+		},
+		"after download": {
+			position: "after:download",
+			expNames: []string{"download", mutator.GATEWAY_INIT_CONTAINER_NAME, mutator.GATEWAY_SIDECAR_CONTAINER_NAME, "setup"},
+		},
+		"before missing container - appended": {
+			position: "before:missing",
+			expNames: []string{"download", "setup", mutator.GATEWAY_INIT_CONTAINER_NAME, mutator.GATEWAY_SIDECAR_CONTAINER_NAME},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			cmdConfig := config.CmdConfig{
+				SetGatewayDefault:     true,
+				Gateway:               testGatewayIP,
+				InitImage:             testInitImage,
+				InitCmd:               testInitCmd,
+				SidecarImage:          testSidecarImage,
+				SidecarCmd:            testSidecarCmd,
+				SidecarAsInit:         true,
+				InitContainerPosition: test.position,
+			}
+			m, err := mutator.NewGatewayPodMutator(mutator.Config{CmdConfig: cmdConfig})
+			require.NoError(err)
+
+			pod := &corev1.Pod{
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{
+						{Name: "download"},
+						{Name: "setup"},
+					},
+				},
+			}
+			_, err = m.GatewayPodMutator(context.TODO(), nil, pod)
+			require.NoError(err)
+
+			var names []string
+			for _, c := range pod.Spec.InitContainers {
+				names = append(names, c.Name)
+			}
+			assert.Equal(test.expNames, names)
+		})
+	}
+}
+
+type fakeNativeSidecar bool
+
+func (f fakeNativeSidecar) NativeSidecarSupported() bool { return bool(f) }
+
+func TestGatewayPodMutatorSidecarMode(t *testing.T) {
+
+	jobPod := func() *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: "batch/v1", Kind: "Job", Name: "backup"},
+				},
+			},
+		}
+	}
+
+	tests := map[string]struct {
+		sidecarMode   string
+		sidecarAsInit bool
+		nativeSidecar mutator.NativeSidecarSupport
+		obj           *corev1.Pod
+		expNative     bool
+		expWarning    bool
+	}{
+		"default is a regular container": {
+			obj: &corev1.Pod{},
+		},
+		"sidecarAsInit": {
+			sidecarAsInit: true,
+			obj:           &corev1.Pod{},
+			expNative:     true,
+		},
+		"container mode overrides sidecarAsInit": {
+			sidecarMode:   "container",
+			sidecarAsInit: true,
+			obj:           &corev1.Pod{},
+		},
+		"auto with native sidecar support": {
+			sidecarMode:   "auto",
+			nativeSidecar: fakeNativeSidecar(true),
+			obj:           jobPod(),
+			expNative:     true,
+		},
+		"auto without native sidecar support": {
+			sidecarMode:   "auto",
+			nativeSidecar: fakeNativeSidecar(false),
+			obj:           &corev1.Pod{},
+		},
+		"auto without detector": {
+			sidecarMode: "auto",
+			obj:         &corev1.Pod{},
+		},
+		"auto without native sidecar support on a Job pod warns": {
+			sidecarMode:   "auto",
+			nativeSidecar: fakeNativeSidecar(false),
+			obj:           jobPod(),
+			expWarning:    true,
+		},
+		"container on a CronJob pod warns": {
+			sidecarMode: "container",
+			obj: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"batch.kubernetes.io/job-name": "backup-28000000"},
+				},
+			},
+			expWarning: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			m, err := mutator.NewGatewayPodMutator(mutator.Config{
+				CmdConfig: config.CmdConfig{
+					SetGatewayDefault: true,
+					Gateway:           testGatewayIP,
+					SidecarImage:      testSidecarImage,
+					SidecarCmd:        testSidecarCmd,
+					SidecarAsInit:     test.sidecarAsInit,
+					SidecarMode:       test.sidecarMode,
+				},
+				NativeSidecar: test.nativeSidecar,
+			})
+			require.NoError(err)
+
+			res, err := m.GatewayPodMutator(context.TODO(), nil, test.obj)
+			require.NoError(err)
+
+			if test.expNative {
+				assert.Empty(test.obj.Spec.Containers)
+				require.Len(test.obj.Spec.InitContainers, 1)
+				assert.Equal(corev1.ContainerRestartPolicyAlways, *test.obj.Spec.InitContainers[0].RestartPolicy)
+			} else {
+				assert.Empty(test.obj.Spec.InitContainers)
+				require.Len(test.obj.Spec.Containers, 1)
+				assert.Nil(test.obj.Spec.Containers[0].RestartPolicy)
+			}
+			if test.expWarning {
+				assert.Len(res.Warnings, 1)
+			} else {
+				assert.Empty(res.Warnings)
+			}
+		})
+	}
+}
+
+func TestGatewayPodMutatorBypassCIDRs(t *testing.T) {
+
+	tests := map[string]struct {
+		bypassCIDRs string
+		annotations map[string]string
+		expEnv      *corev1.EnvVar
+	}{
+		"no bypass CIDRs": {},
+		"global bypass CIDRs": {
+			bypassCIDRs: "10.42.0.0/16, 10.43.0.0/16",
+			expEnv:      &corev1.EnvVar{Name: "BYPASS_CIDRS", Value: "10.42.0.0/16 10.43.0.0/16"},
+		},
+		"global and pod bypass CIDRs are merged": {
+			bypassCIDRs: "10.42.0.0/16,10.43.0.0/16",
+			annotations: map[string]string{
+				mutator.BYPASS_CIDRS_ANNOTATION: "10.43.0.0/16 192.168.1.10/24",
+			},
+			expEnv: &corev1.EnvVar{Name: "BYPASS_CIDRS", Value: "10.42.0.0/16 10.43.0.0/16 192.168.1.0/24"},
+		},
+		"pod bypass CIDRs only": {
+			annotations: map[string]string{
+				mutator.BYPASS_CIDRS_ANNOTATION: "fd00::/8",
+			},
+			expEnv: &corev1.EnvVar{Name: "BYPASS_CIDRS", Value: "fd00::/8"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			m, err := mutator.NewGatewayPodMutator(mutator.Config{
+				CmdConfig: config.CmdConfig{
+					SetGatewayDefault: true,
+					Gateway:           testGatewayIP,
+					InitImage:         testInitImage,
+					InitCmd:           testInitCmd,
+					SidecarImage:      testSidecarImage,
+					SidecarCmd:        testSidecarCmd,
+					BypassCIDRs:       test.bypassCIDRs,
+				},
+			})
+			require.NoError(err)
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: test.annotations,
+				},
+			}
+			_, err = m.GatewayPodMutator(context.TODO(), nil, pod)
+			require.NoError(err)
+
+			require.Len(pod.Spec.InitContainers, 1)
+			require.Len(pod.Spec.Containers, 1)
+			for _, container := range []corev1.Container{pod.Spec.InitContainers[0], pod.Spec.Containers[0]} {
+				var env *corev1.EnvVar
+				for i := range container.Env {
+					if container.Env[i].Name == "BYPASS_CIDRS" {
+						env = &container.Env[i]
+					}
+				}
+				assert.Equal(test.expEnv, env)
+			}
+		})
+	}
+}
+
+func TestGatewayPodMutatorPortForward(t *testing.T) {
+
+	tests := map[string]struct {
+		portForwardRange string
+		portForward      string
+		noSidecar        bool
+		expEnv           []corev1.EnvVar
+		expErr           bool
+	}{
+		"TCP and UDP ports": {
+			portForwardRange: "1024-65535",
+			portForward:      "6881/tcp, 6881/udp,51413",
+			expEnv: []corev1.EnvVar{
+				{Name: "PORT_FORWARD_TCP", Value: "6881 51413"},
+				{Name: "PORT_FORWARD_UDP", Value: "6881"},
+			},
+		},
+		"single allowed port": {
+			portForwardRange: "6881",
+			portForward:      "6881/UDP",
+			expEnv: []corev1.EnvVar{
+				{Name: "PORT_FORWARD_UDP", Value: "6881"},
+			},
+		},
+		"port forwarding disabled": {
+			portForward: "6881",
+			expErr:      true,
+		},
+		"out of range port": {
+			portForwardRange: "1024-65535",
+			portForward:      "80/tcp",
+			expErr:           true,
+		},
+		"duplicated port": {
+			portForwardRange: "1024-65535",
+			portForward:      "6881/tcp,6881",
+			expErr:           true,
+		},
+		"invalid protocol": {
+			portForwardRange: "1024-65535",
+			portForward:      "6881/sctp",
+			expErr:           true,
+		},
+		"invalid port": {
+			portForwardRange: "1024-65535",
+			portForward:      "http",
+			expErr:           true,
+		},
+		"without sidecar": {
+			portForwardRange: "1024-65535",
+			portForward:      "6881",
+			noSidecar:        true,
+			expErr:           true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			cmdConfig := config.CmdConfig{
+				SetGatewayDefault: true,
+				Gateway:           testGatewayIP,
+				InitImage:         testInitImage,
+				InitCmd:           testInitCmd,
+				SidecarImage:      testSidecarImage,
+				SidecarCmd:        testSidecarCmd,
+				PortForwardRange:  test.portForwardRange,
+			}
+			if test.noSidecar {
+				cmdConfig.SidecarImage = ""
+				cmdConfig.SidecarCmd = ""
+			}
+			m, err := mutator.NewGatewayPodMutator(mutator.Config{
+				CmdConfig: cmdConfig,
+			})
+			require.NoError(err)
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						mutator.PORT_FORWARD_ANNOTATION: test.portForward,
+					},
+				},
+			}
+			_, err = m.GatewayPodMutator(context.TODO(), nil, pod)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			require.Len(pod.Spec.InitContainers, 1)
+			require.Len(pod.Spec.Containers, 1)
+			// Only the sidecar gets the ports
+			assert.Len(pod.Spec.InitContainers[0].Env, 4)
+			assert.Equal(test.expEnv, pod.Spec.Containers[0].Env[4:])
+		})
+	}
+}
+
+func TestGatewayPodMutatorKillSwitch(t *testing.T) {
+
+	tests := map[string]struct {
+		killSwitch     bool
+		requiredNs     string
+		namespace      string
+		annotations    map[string]string
+		expKillSwitch  bool
+		expAllowedCIDR string
+		expWarning     bool
+		expErr         bool
+	}{
+		"disabled": {},
+		"enabled globally": {
+			killSwitch:     true,
+			expKillSwitch:  true,
+			expAllowedCIDR: "192.168.0.0/16 10.42.0.0/16",
+		},
+		"disabled by annotation": {
+			killSwitch:  true,
+			annotations: map[string]string{mutator.KILL_SWITCH_ANNOTATION: "false"},
+		},
+		"enabled by annotation": {
+			annotations:    map[string]string{mutator.KILL_SWITCH_ANNOTATION: "true"},
+			expKillSwitch:  true,
+			expAllowedCIDR: "192.168.0.0/16 10.42.0.0/16",
+		},
+		"required namespace": {
+			requiredNs:     "vpn,media",
+			namespace:      "media",
+			expKillSwitch:  true,
+			expAllowedCIDR: "192.168.0.0/16 10.42.0.0/16",
+		},
+		"required namespace cannot be disabled by annotation": {
+			killSwitch:     true,
+			requiredNs:     "media",
+			namespace:      "media",
+			annotations:    map[string]string{mutator.KILL_SWITCH_ANNOTATION: "false"},
+			expKillSwitch:  true,
+			expAllowedCIDR: "192.168.0.0/16 10.42.0.0/16",
+			expWarning:     true,
+		},
+		"other namespace may disable it": {
+			killSwitch:  true,
+			requiredNs:  "media",
+			namespace:   "default",
+			annotations: map[string]string{mutator.KILL_SWITCH_ANNOTATION: "false"},
+		},
+		"invalid annotation": {
+			annotations: map[string]string{mutator.KILL_SWITCH_ANNOTATION: "sometimes"},
+			expErr:      true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			m, err := mutator.NewGatewayPodMutator(mutator.Config{
+				CmdConfig: config.CmdConfig{
+					SetGatewayDefault:      true,
+					Gateway:                testGatewayIP,
+					InitImage:              testInitImage,
+					InitCmd:                testInitCmd,
+					BypassCIDRs:            "10.42.0.0/16",
+					KillSwitch:             test.killSwitch,
+					KillSwitchAllowedCIDRs: "192.168.0.0/16",
+					KillSwitchRequiredNs:   test.requiredNs,
+				},
+			})
+			require.NoError(err)
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   test.namespace,
+					Annotations: test.annotations,
+				},
+			}
+			res, err := m.GatewayPodMutator(context.TODO(), nil, pod)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			require.Len(pod.Spec.InitContainers, 1)
+			env := map[string]string{}
+			for _, e := range pod.Spec.InitContainers[0].Env {
+				env[e.Name] = e.Value
+			}
+			if test.expKillSwitch {
+				assert.Equal("true", env["KILL_SWITCH"])
+				assert.Equal(test.expAllowedCIDR, env["KILL_SWITCH_ALLOWED_CIDRS"])
+				assert.Equal("true", pod.Annotations[mutator.KILL_SWITCH_ACTIVE_ANNOTATION])
+			} else {
+				assert.NotContains(env, "KILL_SWITCH")
+				assert.NotContains(pod.Annotations, mutator.KILL_SWITCH_ACTIVE_ANNOTATION)
+			}
+			assert.Equal(test.expWarning, len(res.Warnings) > 0)
+		})
+	}
+}
+
+// fakeResolver resolves names to IPs until it is broken. IPs resolve to themselves.
+type fakeResolver struct {
+	ips    map[string]string
+	broken bool
+}
+
+func (f *fakeResolver) LookupIP(_ context.Context, _ string, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	if f.broken {
+		return nil, &net.DNSError{Err: "server misbehaving", Name: host}
+	}
+	ip, ok := f.ips[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return []net.IP{net.ParseIP(ip)}, nil
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestGatewayPodMutatorDNSSettings(t *testing.T) {
+	resolvConf := filepath.Join(t.TempDir(), "resolv.conf")
+	require.NoError(t, os.WriteFile(resolvConf, []byte(`nameserver 10.43.0.10
+search kube-system.svc.cluster.local svc.cluster.local cluster.local lan
+options ndots:5
+`), 0o644))
+
+	tests := map[string]struct {
+		cmdConfig   config.CmdConfig
+		namespace   string
+		expSearches []string
+		expOptions  []corev1.PodDNSConfigOption
+	}{
+		"From resolvConf": {
+			namespace:   testNamespace,
+			expSearches: []string{testNamespace + ".svc.cluster.local", "svc.cluster.local", "cluster.local", "lan"},
+			expOptions:  []corev1.PodDNSConfigOption{{Name: "ndots", Value: strPtr("5")}},
+		},
+		"Cluster domain": {
+			cmdConfig:   config.CmdConfig{ClusterDomain: "k8s.example.org."},
+			namespace:   testNamespace,
+			expSearches: []string{testNamespace + ".svc.k8s.example.org", "svc.k8s.example.org", "k8s.example.org"},
+			expOptions:  []corev1.PodDNSConfigOption{{Name: "ndots", Value: strPtr("5")}},
+		},
+		"Cluster domain without namespace": {
+			cmdConfig:   config.CmdConfig{ClusterDomain: "k8s.example.org"},
+			expSearches: []string{"svc.k8s.example.org", "k8s.example.org"},
+			expOptions:  []corev1.PodDNSConfigOption{{Name: "ndots", Value: strPtr("5")}},
+		},
+		"Cluster domain, search and options": {
+			cmdConfig:   config.CmdConfig{ClusterDomain: "k8s.example.org", DNSSearch: "home.arpa", DNSOptions: "ndots:2,edns0"},
+			namespace:   testNamespace,
+			expSearches: []string{testNamespace + ".svc.k8s.example.org", "svc.k8s.example.org", "k8s.example.org", "home.arpa"},
+			expOptions:  []corev1.PodDNSConfigOption{{Name: "ndots", Value: strPtr("2")}, {Name: "edns0"}},
+		},
+		"Search only": {
+			cmdConfig:   config.CmdConfig{DNSSearch: "home.arpa, lan"},
+			namespace:   testNamespace,
+			expSearches: []string{"home.arpa", "lan"},
+			expOptions:  []corev1.PodDNSConfigOption{{Name: "ndots", Value: strPtr("5")}},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			cmdConfig := test.cmdConfig
+			cmdConfig.SetGatewayDefault = true
+			cmdConfig.Gateway = testGatewayIP
+			cmdConfig.DNS = testGatewayIP
+			cmdConfig.DNSPolicy = testDNSPolicy
+			cmdConfig.ResolvConfPath = resolvConf
+			cmdConfig.InitImage = testInitImage
+			m, err := mutator.NewGatewayPodMutator(mutator.Config{
+				CmdConfig: cmdConfig,
+				Resolver:  &fakeResolver{ips: map[string]string{}},
+			})
+			require.NoError(err)
+
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: test.namespace}}
+			_, err = m.GatewayPodMutator(context.TODO(), nil, pod)
+			require.NoError(err)
+
+			require.NotNil(pod.Spec.DNSConfig)
+			assert.Equal([]string{testGatewayIP}, pod.Spec.DNSConfig.Nameservers)
+			assert.Equal(test.expSearches, pod.Spec.DNSConfig.Searches)
+			assert.Equal(test.expOptions, pod.Spec.DNSConfig.Options)
+		})
+	}
+}
+
+func TestGatewayPodMutatorDNSMerge(t *testing.T) {
+	resolvConf := filepath.Join(t.TempDir(), "resolv.conf")
+	require.NoError(t, os.WriteFile(resolvConf, []byte("nameserver 10.43.0.10\nsearch svc.cluster.local\noptions ndots:5 edns0\n"), 0o644))
+
+	manySearches := make([]string, 0, mutator.MAX_DNS_SEARCHES)
+	for i := 0; i < mutator.MAX_DNS_SEARCHES; i++ {
+		manySearches = append(manySearches, fmt.Sprintf("s%d.example", i))
+	}
+	longSearches := []string{strings.Repeat("a", 1020), strings.Repeat("b", 1020)}
+
+	tests := map[string]struct {
+		cmdConfig      config.CmdConfig
+		podDNSConfig   *corev1.PodDNSConfig
+		expNameservers []string
+		expSearches    []string
+		expOptions     []corev1.PodDNSConfigOption
+		expWarnings    int
+	}{
+		"Replace by default": {
+			podDNSConfig:   &corev1.PodDNSConfig{Nameservers: []string{"1.1.1.1"}, Searches: []string{"lan"}, Options: []corev1.PodDNSConfigOption{{Name: "ndots", Value: strPtr("2")}}},
+			expNameservers: []string{"5.6.7.8"},
+			expSearches:    []string{"svc.cluster.local"},
+			expOptions:     []corev1.PodDNSConfigOption{{Name: "ndots", Value: strPtr("5")}, {Name: "edns0"}},
+		},
+		"Pod without dnsConfig": {
+			cmdConfig:      config.CmdConfig{DNSMergeNameservers: config.DNSMergeAppend, DNSMergeSearches: config.DNSMergeKeepPod, DNSMergeOptions: config.DNSMergePrepend},
+			expNameservers: []string{"5.6.7.8"},
+			expSearches:    []string{"svc.cluster.local"},
+			expOptions:     []corev1.PodDNSConfigOption{{Name: "ndots", Value: strPtr("5")}, {Name: "edns0"}},
+		},
+		"Merge append": {
+			cmdConfig:      config.CmdConfig{DNSMergeNameservers: config.DNSMergeAppend, DNSMergeSearches: config.DNSMergeAppend, DNSMergeOptions: config.DNSMergeAppend},
+			podDNSConfig:   &corev1.PodDNSConfig{Nameservers: []string{"1.1.1.1"}, Searches: []string{"lan"}, Options: []corev1.PodDNSConfigOption{{Name: "ndots", Value: strPtr("2")}}},
+			expNameservers: []string{"1.1.1.1", "5.6.7.8"},
+			expSearches:    []string{"lan", "svc.cluster.local"},
+			expOptions:     []corev1.PodDNSConfigOption{{Name: "ndots", Value: strPtr("2")}, {Name: "edns0"}},
+		},
+		"Merge prepend without duplicates": {
+			cmdConfig:      config.CmdConfig{DNSMergeNameservers: config.DNSMergePrepend, DNSMergeSearches: config.DNSMergePrepend, DNSMergeOptions: config.DNSMergePrepend},
+			podDNSConfig:   &corev1.PodDNSConfig{Nameservers: []string{"1.1.1.1", "5.6.7.8"}, Searches: []string{"svc.cluster.local", "lan"}, Options: []corev1.PodDNSConfigOption{{Name: "ndots", Value: strPtr("2")}, {Name: "rotate"}}},
+			expNameservers: []string{"5.6.7.8", "1.1.1.1"},
+			expSearches:    []string{"svc.cluster.local", "lan"},
+			expOptions:     []corev1.PodDNSConfigOption{{Name: "ndots", Value: strPtr("5")}, {Name: "edns0"}, {Name: "rotate"}},
+		},
+		"Keep pod": {
+			cmdConfig:      config.CmdConfig{DNSMergeNameservers: config.DNSMergeReplace, DNSMergeSearches: config.DNSMergeKeepPod, DNSMergeOptions: config.DNSMergeKeepPod},
+			podDNSConfig:   &corev1.PodDNSConfig{Nameservers: []string{"1.1.1.1"}, Options: []corev1.PodDNSConfigOption{{Name: "ndots", Value: strPtr("2")}}},
+			expNameservers: []string{"5.6.7.8"},
+			expSearches:    []string{"svc.cluster.local"},
+			expOptions:     []corev1.PodDNSConfigOption{{Name: "ndots", Value: strPtr("2")}},
+		},
+		"Too many nameservers": {
+			cmdConfig:      config.CmdConfig{DNSMergeNameservers: config.DNSMergeAppend},
+			podDNSConfig:   &corev1.PodDNSConfig{Nameservers: []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"}},
+			expNameservers: []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"},
+			expSearches:    []string{"svc.cluster.local"},
+			expOptions:     []corev1.PodDNSConfigOption{{Name: "ndots", Value: strPtr("5")}, {Name: "edns0"}},
+			expWarnings:    1,
+		},
+		"Too many searches": {
+			cmdConfig:      config.CmdConfig{DNSMergeSearches: config.DNSMergePrepend},
+			podDNSConfig:   &corev1.PodDNSConfig{Searches: manySearches},
+			expNameservers: []string{"5.6.7.8"},
+			expSearches:    append([]string{"svc.cluster.local"}, manySearches[:mutator.MAX_DNS_SEARCHES-1]...),
+			expOptions:     []corev1.PodDNSConfigOption{{Name: "ndots", Value: strPtr("5")}, {Name: "edns0"}},
+			expWarnings:    1,
+		},
+		"Search list too long": {
+			cmdConfig:      config.CmdConfig{DNSMergeSearches: config.DNSMergeAppend},
+			podDNSConfig:   &corev1.PodDNSConfig{Searches: longSearches},
+			expNameservers: []string{"5.6.7.8"},
+			expSearches:    longSearches,
+			expOptions:     []corev1.PodDNSConfigOption{{Name: "ndots", Value: strPtr("5")}, {Name: "edns0"}},
+			expWarnings:    1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			cmdConfig := test.cmdConfig
+			cmdConfig.SetGatewayDefault = true
+			cmdConfig.Gateway = testGatewayIP
+			cmdConfig.DNS = "5.6.7.8"
+			cmdConfig.DNSPolicy = testDNSPolicy
+			cmdConfig.ResolvConfPath = resolvConf
+			cmdConfig.InitImage = testInitImage
+			m, err := mutator.NewGatewayPodMutator(mutator.Config{
+				CmdConfig: cmdConfig,
+				Resolver:  &fakeResolver{ips: map[string]string{}},
+			})
+			require.NoError(err)
+
+			pod := &corev1.Pod{Spec: corev1.PodSpec{DNSConfig: test.podDNSConfig.DeepCopy()}}
+			res, err := m.GatewayPodMutator(context.TODO(), nil, pod)
+			require.NoError(err)
+
+			require.NotNil(pod.Spec.DNSConfig)
+			assert.Equal(test.expNameservers, pod.Spec.DNSConfig.Nameservers)
+			assert.Equal(test.expSearches, pod.Spec.DNSConfig.Searches)
+			assert.Equal(test.expOptions, pod.Spec.DNSConfig.Options)
+			assert.Len(res.Warnings, test.expWarnings)
+		})
+	}
+}
+
+func TestGatewayPodMutatorDNSOverrides(t *testing.T) {
+	resolvConf := filepath.Join(t.TempDir(), "resolv.conf")
+	require.NoError(t, os.WriteFile(resolvConf, []byte("nameserver 10.43.0.10\nsearch svc.cluster.local\noptions ndots:5\n"), 0o644))
+
+	allOverrides := "dns,dns-policy,dns-options"
+	tests := map[string]struct {
+		allowed      string
+		annotations  map[string]string
+		expErr       bool
+		expDNSPolicy corev1.DNSPolicy
+		expDNSConfig *corev1.PodDNSConfig
+	}{
+		"Without overrides": {
+			allowed:      allOverrides,
+			expDNSPolicy: corev1.DNSNone,
+			expDNSConfig: &corev1.PodDNSConfig{Nameservers: []string{"5.6.7.8"}, Searches: []string{"svc.cluster.local"}, Options: []corev1.PodDNSConfigOption{{Name: "ndots", Value: strPtr("5")}}},
+		},
+		"Override not allowed": {
+			allowed:     "dns",
+			annotations: map[string]string{mutator.DNS_POLICY_ANNOTATION: "ClusterFirst"},
+			expErr:      true,
+		},
+		"No overrides allowed by default": {
+			annotations: map[string]string{mutator.DNS_ANNOTATION: "1.1.1.1"},
+			expErr:      true,
+		},
+		"DNS servers": {
+			allowed:      allOverrides,
+			annotations:  map[string]string{mutator.DNS_ANNOTATION: "1.1.1.1, 8.8.8.8"},
+			expDNSPolicy: corev1.DNSNone,
+			expDNSConfig: &corev1.PodDNSConfig{Nameservers: []string{"1.1.1.1", "8.8.8.8"}, Searches: []string{"svc.cluster.local"}, Options: []corev1.PodDNSConfigOption{{Name: "ndots", Value: strPtr("5")}}},
+		},
+		"Cluster DNS through the gateway": {
+			allowed:      allOverrides,
+			annotations:  map[string]string{mutator.DNS_ANNOTATION: "", mutator.DNS_POLICY_ANNOTATION: "ClusterFirst"},
+			expDNSPolicy: corev1.DNSClusterFirst,
+		},
+		"Gateway as extra nameserver": {
+			allowed:      allOverrides,
+			annotations:  map[string]string{mutator.DNS_POLICY_ANNOTATION: "ClusterFirst"},
+			expDNSPolicy: corev1.DNSClusterFirst,
+			expDNSConfig: &corev1.PodDNSConfig{Nameservers: []string{"5.6.7.8"}},
+		},
+		"Invalid DNS policy": {
+			allowed:     allOverrides,
+			annotations: map[string]string{mutator.DNS_POLICY_ANNOTATION: "Gateway"},
+			expErr:      true,
+		},
+		"DNS options": {
+			allowed:      allOverrides,
+			annotations:  map[string]string{mutator.DNS_OPTIONS_ANNOTATION: "ndots:2,edns0"},
+			expDNSPolicy: corev1.DNSNone,
+			expDNSConfig: &corev1.PodDNSConfig{Nameservers: []string{"5.6.7.8"}, Searches: []string{"svc.cluster.local"}, Options: []corev1.PodDNSConfigOption{{Name: "ndots", Value: strPtr("2")}, {Name: "edns0"}}},
+		},
+		"DNS options without DNS server": {
+			allowed:     allOverrides,
+			annotations: map[string]string{mutator.DNS_ANNOTATION: "", mutator.DNS_OPTIONS_ANNOTATION: "ndots:2"},
+			expErr:      true,
+		},
+		"DNS policy None annotation without DNS server": {
+			allowed:     allOverrides,
+			annotations: map[string]string{mutator.DNS_ANNOTATION: "", mutator.DNS_POLICY_ANNOTATION: "None"},
+			expErr:      true,
+		},
+		"Configured DNS policy None without DNS server": {
+			allowed:     allOverrides,
+			annotations: map[string]string{mutator.DNS_ANNOTATION: ""},
+			expErr:      true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			m, err := mutator.NewGatewayPodMutator(mutator.Config{
+				CmdConfig: config.CmdConfig{
+					SetGatewayDefault:   true,
+					Gateway:             testGatewayIP,
+					DNS:                 "5.6.7.8",
+					DNSPolicy:           testDNSPolicy,
+					ResolvConfPath:      resolvConf,
+					AllowedDNSOverrides: test.allowed,
+					InitImage:           testInitImage,
+				},
+				Resolver: &fakeResolver{ips: map[string]string{}},
+			})
+			require.NoError(err)
+
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test", Annotations: test.annotations}}
+			_, err = m.GatewayPodMutator(context.TODO(), nil, pod)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(test.expDNSPolicy, pod.Spec.DNSPolicy)
+			assert.Equal(test.expDNSConfig, pod.Spec.DNSConfig)
+		})
+	}
+}
+
+func TestGatewayPodMutatorInvalidDNSSettings(t *testing.T) {
+	for name, cmdConfig := range map[string]config.CmdConfig{
+		"Invalid DNSPolicy":          {DNSPolicy: "Gateway"},
+		"Unknown allowed override":   {AllowedDNSOverrides: "dns,gateway"},
+		"Invalid DNS merge strategy": {DNSMergeSearches: "merge"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := mutator.NewGatewayPodMutator(mutator.Config{CmdConfig: cmdConfig})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestGatewayPodMutatorFailurePolicy(t *testing.T) {
+
+	tests := map[string]struct {
+		cmdConfig   config.CmdConfig
+		resolved    bool
+		brokenDNS   bool
+		annotations map[string]string
+		containers  []corev1.Container
+		expErr      bool
+		expMutated  bool
+		expDNSIPs   []string
+		expWarning  bool
+	}{
+		"DNS failure is denied by default": {
+			brokenDNS: true,
+			expErr:    true,
+		},
+		"DNS failure allowed unmutated": {
+			cmdConfig:  config.CmdConfig{FailurePolicyDNS: config.FailurePolicyAllow},
+			brokenDNS:  true,
+			expWarning: true,
+		},
+		"DNS failure uses the last known addresses": {
+			cmdConfig:  config.CmdConfig{FailurePolicyDNS: config.FailurePolicyLastKnownGood},
+			resolved:   true,
+			brokenDNS:  true,
+			expMutated: true,
+			expDNSIPs:  []string{"5.6.7.8"},
+			expWarning: true,
+		},
+		"DNS failure uses the addresses resolved at startup": {
+			cmdConfig:  config.CmdConfig{FailurePolicyDNS: config.FailurePolicyLastKnownGood},
+			brokenDNS:  true,
+			expMutated: true,
+			expDNSIPs:  []string{"5.6.7.8"},
+			expWarning: true,
+		},
+		"DNS failure of an overridden DNS is denied": {
+			cmdConfig:   config.CmdConfig{FailurePolicyDNS: config.FailurePolicyLastKnownGood, AllowedDNSOverrides: "dns"},
+			annotations: map[string]string{mutator.DNS_ANNOTATION: "other-dns.example.com"},
+			brokenDNS:   true,
+			expErr:      true,
+		},
+		"Invalid annotation is denied by default": {
+			annotations: map[string]string{mutator.KILL_SWITCH_ANNOTATION: "sometimes"},
+			expErr:      true,
+		},
+		"Invalid annotation allowed unmutated": {
+			cmdConfig:   config.CmdConfig{FailurePolicyAnnotation: config.FailurePolicyAllow},
+			annotations: map[string]string{mutator.BYPASS_CIDRS_ANNOTATION: "not-a-cidr"},
+			expWarning:  true,
+		},
+		"Env template failure is denied by default": {
+			cmdConfig:   config.CmdConfig{Env: map[string]string{"PORTS": "{{ .Pod.Annotations.ports.number }}"}},
+			annotations: map[string]string{"ports": "6881"},
+			expErr:      true,
+		},
+		"Mount point template failure allowed unmutated": {
+			cmdConfig: config.CmdConfig{
+				FailurePolicyAnnotation: config.FailurePolicyAllow,
+				SidecarMountPoint:       "/config/{{ .Pod.Annotations.ports.number }}",
+				ConfigmapName:           testConfigmapName,
+			},
+			annotations: map[string]string{"ports": "6881"},
+			expWarning:  true,
+		},
+		"Name conflict is denied by default": {
+			containers: []corev1.Container{{Name: mutator.GATEWAY_SIDECAR_CONTAINER_NAME}},
+			expErr:     true,
+		},
+		"Name conflict allowed unmutated": {
+			cmdConfig:  config.CmdConfig{FailurePolicyNameConflict: config.FailurePolicyAllow},
+			containers: []corev1.Container{{Name: mutator.GATEWAY_SIDECAR_CONTAINER_NAME}},
+			expWarning: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			resolver := &fakeResolver{ips: map[string]string{"dns.example.com": "5.6.7.8"}}
+			cmdConfig := test.cmdConfig
+			cmdConfig.SetGatewayDefault = true
+			cmdConfig.Gateway = testGatewayIP
+			cmdConfig.DNS = "dns.example.com"
+			cmdConfig.SidecarImage = testSidecarImage
+			m, err := mutator.NewGatewayPodMutator(mutator.Config{
+				CmdConfig: cmdConfig,
+				Resolver:  resolver,
+			})
+			require.NoError(err)
+
+			newPod := func() *corev1.Pod {
+				return &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{Name: "test", Annotations: test.annotations},
+					Spec:       corev1.PodSpec{Containers: append([]corev1.Container{}, test.containers...)},
+				}
+			}
+			if test.resolved {
+				_, err := m.GatewayPodMutator(context.TODO(), nil, newPod())
+				require.NoError(err)
+			}
+			resolver.broken = test.brokenDNS
+
+			pod := newPod()
+			res, err := m.GatewayPodMutator(context.TODO(), nil, pod)
+			if test.expErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+
+			gotPod := res.MutatedObject.(*corev1.Pod)
+			if test.expMutated {
+				require.NotNil(gotPod.Spec.DNSConfig)
+				assert.Equal(test.expDNSIPs, gotPod.Spec.DNSConfig.Nameservers)
+			} else {
+				assert.Equal(newPod(), gotPod)
+			}
+			assert.Equal(test.expWarning, len(res.Warnings) > 0)
+		})
+	}
+}
+
+func TestGatewayPodMutatorTracing(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	m, err := mutator.NewGatewayPodMutator(mutator.Config{
+		CmdConfig: config.CmdConfig{
+			SetGatewayDefault: true,
+			Gateway:           testGatewayIP,
+			DNS:               "dns.example.com",
+			InitImage:         testInitImage,
+		},
+		Resolver:       &fakeResolver{ips: map[string]string{"dns.example.com": "5.6.7.8"}},
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+	})
+	require.NoError(err)
+
+	adReview := &kwhmodel.AdmissionReview{ID: "test-uid", Namespace: "media"}
+	_, err = m.GatewayPodMutator(context.TODO(), adReview, &corev1.Pod{})
+	require.NoError(err)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	require.Contains(spans, "GatewayPodMutator")
+	require.Contains(spans, "selection")
+	require.Contains(spans, "dns.resolve")
+
+	attrs := map[attribute.Key]string{}
+	for _, kv := range spans["GatewayPodMutator"].Attributes() {
+		attrs[kv.Key] = kv.Value.Emit()
+	}
+	assert.Equal("test-uid", attrs["admission.uid"])
+	assert.Equal("media", attrs["k8s.namespace.name"])
+	assert.Equal("inject", attrs["gateway.decision"])
+	assert.Equal(spans["GatewayPodMutator"].SpanContext().SpanID(), spans["dns.resolve"].Parent().SpanID())
+}
+
+func TestGatewayPodMutatorRequestLogger(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	logger := logtest.New()
+	resolver := &fakeResolver{ips: map[string]string{"dns.example.com": "5.6.7.8"}}
+	m, err := mutator.NewGatewayPodMutator(mutator.Config{
+		CmdConfig: config.CmdConfig{
+			SetGatewayDefault: true,
+			Gateway:           testGatewayIP,
+			DNS:               "dns.example.com",
+			InitImage:         testInitImage,
+		},
+		Logger:   logger,
+		Resolver: resolver,
+	})
+	require.NoError(err)
+	logger.Reset()
+	resolver.broken = true
+
+	// Set by the Kubewebhook HTTP handler for every admission review
+	ctx := kwhlog.CtxWithValues(context.TODO(), kwhlog.Kv{"request-id": "test-uid", "op": "create", "ns": testNamespace})
+	_, err = m.GatewayPodMutator(ctx, &kwhmodel.AdmissionReview{ID: "test-uid", Namespace: testNamespace}, &corev1.Pod{})
+	require.Error(err)
+
+	entries := logger.Entries()
+	require.NotEmpty(entries)
+	for _, entry := range entries {
+		assert.Equal("test-uid", entry.KV["request-id"], entry.Message)
+		assert.Equal("create", entry.KV["op"], entry.Message)
+		assert.Equal(testNamespace, entry.KV["ns"], entry.Message)
+	}
+	assert.Equal("failure-policy", entries[0].KV["audit"])
+
+	// The DNS config logs of the resolver component too
+	resolvConf := filepath.Join(t.TempDir(), "resolv.conf")
+	require.NoError(os.WriteFile(resolvConf, []byte("nameserver 10.43.0.10\nsearch kube-system.svc.cluster.local svc.cluster.local\n"), 0o644))
+	m, err = mutator.NewGatewayPodMutator(mutator.Config{
+		CmdConfig: config.CmdConfig{
+			SetGatewayDefault: true,
+			Gateway:           testGatewayIP,
+			DNS:               testGatewayIP,
+			DNSPolicy:         testDNSPolicy,
+			ResolvConfPath:    resolvConf,
+			InitImage:         testInitImage,
+		},
+		Logger:   logger,
+		Resolver: &fakeResolver{},
+	})
+	require.NoError(err)
+	logger.Reset()
+
+	_, err = m.GatewayPodMutator(ctx, &kwhmodel.AdmissionReview{ID: "test-uid", Namespace: testNamespace}, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace}})
+	require.NoError(err)
+
+	resolverEntries := 0
+	for _, entry := range logger.Entries() {
+		assert.Equal("test-uid", entry.KV["request-id"], entry.Message)
+		if entry.KV[log.ComponentKey] == log.ComponentResolver {
+			resolverEntries++
+		}
+	}
+	assert.NotZero(resolverEntries)
+}
+
+func TestGatewayPodMutatorStatus(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	resolvConf := filepath.Join(t.TempDir(), "resolv.conf")
+	require.NoError(os.WriteFile(resolvConf, []byte("nameserver 10.43.0.10\nsearch svc.cluster.local\noptions ndots:5\n"), 0o644))
+
+	status := &mutator.Status{}
+	resolver := &fakeResolver{ips: map[string]string{"gateway.example.com": "1.2.3.4", "dns.example.com": "5.6.7.8"}}
+	m, err := mutator.NewGatewayPodMutator(mutator.Config{
+		CmdConfig: config.CmdConfig{
+			SetGatewayDefault: true,
+			Gateway:           "gateway.example.com",
+			DNS:               "dns.example.com",
+			DNSPolicy:         testDNSPolicy,
+			ResolvConfPath:    resolvConf,
+			InitImage:         testInitImage,
+		},
+		Resolver: resolver,
+		Status:   status,
+	})
+	require.NoError(err)
+
+	// Resolved when the mutator starts
+	started := status.Snapshot()
+	require.NotNil(started.Gateway)
+	assert.Equal("gateway.example.com", started.Gateway.Hosts)
+	assert.Equal([]string{"1.2.3.4"}, started.Gateway.IPs)
+	assert.False(started.Gateway.ResolvedAt.IsZero())
+	require.NotNil(started.DNS)
+	assert.Equal("dns.example.com", started.DNS.Hosts)
+	assert.Equal([]string{"5.6.7.8"}, started.DNS.IPs)
+	assert.Equal(&corev1.PodDNSConfig{
+		Nameservers: []string{"10.43.0.10"},
+		Searches:    []string{"svc.cluster.local"},
+		Options:     []corev1.PodDNSConfigOption{{Name: "ndots", Value: strPtr("5")}},
+	}, started.StaticDNS)
+
+	// Updated by the admissions
+	resolver.ips["dns.example.com"] = "5.6.7.9"
+	_, err = m.GatewayPodMutator(context.TODO(), nil, &corev1.Pod{})
+	require.NoError(err)
+	mutated := status.Snapshot()
+	assert.Equal([]string{"5.6.7.9"}, mutated.DNS.IPs)
+	assert.False(mutated.DNS.ResolvedAt.Before(started.DNS.ResolvedAt))
+	assert.Equal([]string{"5.6.7.8"}, started.DNS.IPs, "snapshots are copies")
+
+	// Failed lookups keep the last resolution
+	resolver.broken = true
+	_, err = m.GatewayPodMutator(context.TODO(), nil, &corev1.Pod{})
+	require.Error(err)
+	assert.Equal(mutated, status.Snapshot())
+}
+
+func TestValidate(t *testing.T) {
+	tests := map[string]struct {
+		cmdConfig   config.CmdConfig
+		expProblems []string
+	}{
+		"Valid": {
+			cmdConfig: config.CmdConfig{
+				Gateway:                "gateway.example.com",
+				BypassCIDRs:            "10.42.0.0/16",
+				PortForwardRange:       "1024-65535",
+				InitContainerPosition:  "after:istio-init",
+				AllowedDNSOverrides:    "dns,dns-policy",
+				KillSwitchAllowedCIDRs: "192.168.0.0/24",
+				ConfigmapName:          "settings",
+				InitMountPoint:         "/config/{{ .Namespace }}",
+				Env:                    map[string]string{"NAMESPACE": "{{ .Namespace }}"},
+			},
+		},
+		"Config and mutator problems together": {
+			cmdConfig: config.CmdConfig{
+				DNSPolicy:              "none",
+				BypassCIDRs:            "foo",
+				PortForwardRange:       "9-1",
+				InitContainerPosition:  "middle",
+				AllowedDNSOverrides:    "nope",
+				KillSwitchAllowedCIDRs: "10.0.0.0/33",
+				ConfigmapName:          "settings",
+				InitMountPoint:         "/x/{{ .Foo",
+				SidecarMountPoint:      "/y/{{ .Bar",
+				Env:                    map[string]string{"A": "{{ .Foo"},
+			},
+			expProblems: []string{
+				`dns-policy "none" must be one of ClusterFirst, ClusterFirstWithHostNet, Default, None`,
+				"env: ",
+				"init-mount-point: ",
+				"sidecar-mount-point: ",
+				"init-container-position: ",
+				"bypass-cidrs: ",
+				"port-forward-range: ",
+				"kill-switch-allowed-cidrs: ",
+				"allowed-dns-overrides: ",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := mutator.Validate(test.cmdConfig)
+			if test.expProblems == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var validationErr config.ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			require.Len(t, validationErr.Problems, len(test.expProblems))
+			for i, expProblem := range test.expProblems {
+				assert.True(t, strings.HasPrefix(validationErr.Problems[i], expProblem), validationErr.Problems[i])
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package gatewayPodMutator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// portRange is the range of ports pods may ask to forward.
+type portRange struct {
+	min int
+	max int
+}
+
+// parsePortRange parses <min>-<max> or a single port. An empty value disables port forwarding.
+func parsePortRange(value string) (*portRange, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	first, last, isRange := strings.Cut(value, "-")
+	if !isRange {
+		last = first
+	}
+	low, err := parsePort(first)
+	if err != nil {
+		return nil, err
+	}
+	high, err := parsePort(last)
+	if err != nil {
+		return nil, err
+	}
+	if low > high {
+		return nil, fmt.Errorf("invalid port range %q", value)
+	}
+	return &portRange{min: low, max: high}, nil
+}
+
+func parsePort(value string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", value)
+	}
+	return port, nil
+}
+
+func (r portRange) String() string {
+	return fmt.Sprintf("%d-%d", r.min, r.max)
+}
+
+// portForward is a port a pod wants exposed through the gateway.
+type portForward struct {
+	port     int
+	protocol corev1.Protocol
+}
+
+// parsePortForwards parses a list of <port>[/<protocol>] entries, protocol defaults to TCP.
+func parsePortForwards(value string, allowed *portRange) ([]portForward, error) {
+	if allowed == nil {
+		return nil, fmt.Errorf("port forwarding is not enabled")
+	}
+
+	var forwards []portForward
+	seen := map[portForward]bool{}
+	for _, entry := range splitList(value) {
+		portValue, protocolValue, _ := strings.Cut(entry, "/")
+		port, err := parsePort(portValue)
+		if err != nil {
+			return nil, err
+		}
+		if port < allowed.min || port > allowed.max {
+			return nil, fmt.Errorf("port %d is out of the allowed range %s", port, allowed)
+		}
+
+		protocol := corev1.ProtocolTCP
+		switch strings.ToUpper(protocolValue) {
+		case "", string(corev1.ProtocolTCP):
+		case string(corev1.ProtocolUDP):
+			protocol = corev1.ProtocolUDP
+		default:
+			return nil, fmt.Errorf("invalid protocol %q for port %d", protocolValue, port)
+		}
+
+		forward := portForward{port: port, protocol: protocol}
+		if seen[forward] {
+			return nil, fmt.Errorf("duplicated port forward %d/%s", port, protocol)
+		}
+		seen[forward] = true
+		forwards = append(forwards, forward)
+	}
+	return forwards, nil
+}
+
+// portForwardEnv returns the env for the sidecar with the ports to forward per protocol.
+func portForwardEnv(forwards []portForward) []corev1.EnvVar {
+	var env []corev1.EnvVar
+	for _, protocol := range []corev1.Protocol{corev1.ProtocolTCP, corev1.ProtocolUDP} {
+		var ports []string
+		for _, forward := range forwards {
+			if forward.protocol == protocol {
+				ports = append(ports, strconv.Itoa(forward.port))
+			}
+		}
+		if len(ports) > 0 {
+			env = append(env, corev1.EnvVar{
+				Name:  "PORT_FORWARD_" + string(protocol),
+				Value: strings.Join(ports, " "),
+			})
+		}
+	}
+	return env
+}
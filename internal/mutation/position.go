@@ -0,0 +1,75 @@
+package gatewayPodMutator
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	POSITION_FIRST  = "first"
+	POSITION_LAST   = "last"
+	POSITION_BEFORE = "before"
+	POSITION_AFTER  = "after"
+)
+
+// containerPosition tells where the injected init containers go among the pod init containers.
+type containerPosition struct {
+	kind string
+	// container is the anchor for before/after
+	container string
+}
+
+// parseContainerPosition parses first, last, before:<container> or after:<container>.
+func parseContainerPosition(value string) (containerPosition, error) {
+	if value == "" {
+		return containerPosition{kind: POSITION_LAST}, nil
+	}
+
+	kind, container, _ := strings.Cut(value, ":")
+	switch kind {
+	case POSITION_FIRST, POSITION_LAST:
+		if container != "" {
+			return containerPosition{}, fmt.Errorf("init container position %q does not take a container name", value)
+		}
+	case POSITION_BEFORE, POSITION_AFTER:
+		if container == "" {
+			return containerPosition{}, fmt.Errorf("init container position %q requires a container name", value)
+		}
+	default:
+		return containerPosition{}, fmt.Errorf("invalid init container position %q: use first, last, before:<container> or after:<container>", value)
+	}
+	return containerPosition{kind: kind, container: container}, nil
+}
+
+// insert returns the pod init containers with the injected ones placed as a block.
+// The second return value is false when the anchor container is missing, in which
+// case the injected containers are appended.
+func (p containerPosition) insert(existing []corev1.Container, injected []corev1.Container) ([]corev1.Container, bool) {
+	index := len(existing)
+	found := true
+
+	switch p.kind {
+	case POSITION_FIRST:
+		index = 0
+	case POSITION_BEFORE, POSITION_AFTER:
+		found = false
+		for i := range existing {
+			if existing[i].Name == p.container {
+				index = i
+				if p.kind == POSITION_AFTER {
+					index++
+				}
+				found = true
+				break
+			}
+		}
+	}
+
+	result := make([]corev1.Container, 0, len(existing)+len(injected))
+	result = append(result, existing[:index]...)
+	result = append(result, injected...)
+	result = append(result, existing[index:]...)
+	return result, found
+}
@@ -0,0 +1,68 @@
+package gatewayPodMutator
+
+import (
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Resolution is the last successful lookup of a host list.
+type Resolution struct {
+	Hosts      string    `json:"hosts"`
+	IPs        []string  `json:"ips"`
+	ResolvedAt time.Time `json:"resolvedAt"`
+}
+
+// StatusSnapshot is what the mutator currently uses.
+type StatusSnapshot struct {
+	Gateway *Resolution `json:"gateway,omitempty"`
+	DNS     *Resolution `json:"dns,omitempty"`
+	// StaticDNS is the DNS config copied to the pods with the None DNSPolicy.
+	StaticDNS *corev1.PodDNSConfig `json:"staticDNS,omitempty"`
+}
+
+// Status keeps the state of a running mutator so it can be inspected. It is safe for
+// concurrent use and shared by all the copies of the mutator config.
+type Status struct {
+	mu       sync.Mutex
+	snapshot StatusSnapshot
+}
+
+func (s *Status) setGateway(hosts string, ip string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot.Gateway = &Resolution{Hosts: hosts, IPs: []string{ip}, ResolvedAt: time.Now()}
+}
+
+func (s *Status) setDNS(hosts string, ips []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot.DNS = &Resolution{Hosts: hosts, IPs: append([]string{}, ips...), ResolvedAt: time.Now()}
+}
+
+func (s *Status) setStaticDNS(dnsConfig corev1.PodDNSConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot.StaticDNS = dnsConfig.DeepCopy()
+}
+
+// Snapshot returns a copy of the current state.
+func (s *Status) Snapshot() StatusSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return StatusSnapshot{
+		Gateway:   s.snapshot.Gateway.copy(),
+		DNS:       s.snapshot.DNS.copy(),
+		StaticDNS: s.snapshot.StaticDNS.DeepCopy(),
+	}
+}
+
+func (r *Resolution) copy() *Resolution {
+	if r == nil {
+		return nil
+	}
+	copied := *r
+	copied.IPs = append([]string{}, r.IPs...)
+	return &copied
+}
@@ -0,0 +1,140 @@
+package gatewayPodMutator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/angelnu/gateway-admision-controller/internal/resolv"
+)
+
+// templateData is the data the env and mount point templates are rendered against.
+type templateData struct {
+	// Pod is the metadata of the pod being admitted
+	Pod metav1.ObjectMeta
+	// Namespace is the namespace of the admission request (pod namespace if empty)
+	Namespace string
+	// Gateway is the configured gateway name/IP
+	Gateway string
+	// DNS is the configured DNS name/IP list
+	DNS string
+	// DNSIPs are the resolved DNS IPs
+	DNSIPs []string
+	// K8sDNSIPs are the nameservers of the webhook resolv.conf
+	K8sDNSIPs []string
+
+	// dnsConfig is the DNS config of the mutated pod
+	dnsConfig *corev1.PodDNSConfig
+	cfg       gatewayPodMutatorCfg
+	ctx       context.Context
+}
+
+// GatewayIP resolves the gateway when a template asks for it.
+func (d templateData) GatewayIP() (string, error) {
+	if d.Gateway == "" {
+		return "", nil
+	}
+	return d.cfg.getGatewayIP(d.ctx)
+}
+
+// ResolvConf renders the DNS config of the mutated pod in resolv.conf format, for
+// gateway images that write their own /etc/resolv.conf.
+func (d templateData) ResolvConf() string {
+	if d.dnsConfig == nil {
+		return ""
+	}
+	return resolv.FromPodDNSConfig(*d.dnsConfig).String()
+}
+
+var templateFuncs = template.FuncMap{
+	"join": func(elems []string, sep string) string {
+		return strings.Join(elems, sep)
+	},
+	"default": func(def string, value string) string {
+		if value == "" {
+			return def
+		}
+		return value
+	},
+}
+
+// reservedEnv are the env names set by the mutator itself.
+var reservedEnv = map[string]bool{
+	"gateway":                   true,
+	"DNS":                       true,
+	"DNS_ips":                   true,
+	"K8S_DNS_ips":               true,
+	"BYPASS_CIDRS":              true,
+	"PORT_FORWARD_TCP":          true,
+	"PORT_FORWARD_UDP":          true,
+	"KILL_SWITCH":               true,
+	"KILL_SWITCH_ALLOWED_CIDRS": true,
+}
+
+type envTemplate struct {
+	name     string
+	template *template.Template
+}
+
+func parseTemplate(name string, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse template %q: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// parseEnvTemplates parses the extra env values once so they can be rendered for each pod.
+func parseEnvTemplates(env map[string]string) ([]envTemplate, error) {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	// Keep the injected env stable between admissions
+	sort.Strings(names)
+
+	templates := make([]envTemplate, 0, len(names))
+	for _, name := range names {
+		if reservedEnv[name] {
+			return nil, fmt.Errorf("env %q is reserved", name)
+		}
+		tmpl, err := parseTemplate("env "+name, env[name])
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, envTemplate{name: name, template: tmpl})
+	}
+	return templates, nil
+}
+
+func renderTemplate(tmpl *template.Template, data templateData) (string, error) {
+	if tmpl == nil {
+		return "", nil
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("could not render %s: %w", tmpl.Name(), err)
+	}
+	return out.String(), nil
+}
+
+func renderEnv(templates []envTemplate, data templateData) ([]corev1.EnvVar, error) {
+	env := make([]corev1.EnvVar, 0, len(templates))
+	for _, t := range templates {
+		value, err := renderTemplate(t.template, data)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, corev1.EnvVar{
+			Name:  t.name,
+			Value: value,
+		})
+	}
+	return env, nil
+}
@@ -0,0 +1,52 @@
+package gatewayPodMutator
+
+import (
+	"errors"
+
+	"github.com/angelnu/gateway-admision-controller/internal/config"
+)
+
+// Validate checks the configuration like config.CmdConfig.Validate and also parses the
+// settings that only the mutator understands, without resolving the gateway or DNS.
+// All the problems are returned together in a config.ValidationError.
+func Validate(cmdConfig config.CmdConfig) error {
+	var problems []string
+	var validationErr config.ValidationError
+	if err := cmdConfig.Validate(); errors.As(err, &validationErr) {
+		problems = append(problems, validationErr.Problems...)
+	} else if err != nil {
+		return err
+	}
+
+	// The enums are already checked by config.CmdConfig.Validate
+	_, envErr := parseEnvTemplates(cmdConfig.Env)
+	_, initMountPointErr := parseTemplate("initMountPoint", cmdConfig.InitMountPoint)
+	_, sidecarMountPointErr := parseTemplate("sidecarMountPoint", cmdConfig.SidecarMountPoint)
+	_, initContainerPositionErr := parseContainerPosition(cmdConfig.InitContainerPosition)
+	_, bypassCIDRsErr := parseCIDRs(cmdConfig.BypassCIDRs)
+	_, portForwardRangeErr := parsePortRange(cmdConfig.PortForwardRange)
+	_, killSwitchAllowedCIDRsErr := parseCIDRs(cmdConfig.KillSwitchAllowedCIDRs)
+	_, allowedDNSOverridesErr := parseAllowedDNSOverrides(cmdConfig.AllowedDNSOverrides)
+	for _, check := range []struct {
+		option string
+		err    error
+	}{
+		{"env", envErr},
+		{"init-mount-point", initMountPointErr},
+		{"sidecar-mount-point", sidecarMountPointErr},
+		{"init-container-position", initContainerPositionErr},
+		{"bypass-cidrs", bypassCIDRsErr},
+		{"port-forward-range", portForwardRangeErr},
+		{"kill-switch-allowed-cidrs", killSwitchAllowedCIDRsErr},
+		{"allowed-dns-overrides", allowedDNSOverridesErr},
+	} {
+		if check.err != nil {
+			problems = append(problems, check.option+": "+check.err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		return config.ValidationError{Problems: problems}
+	}
+	return nil
+}
@@ -4,7 +4,25 @@ import (
 	"bufio"
 	"io"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+)
+
+const (
+	// DefaultPath is the resolv.conf of the host or container.
+	DefaultPath = "/etc/resolv.conf"
+
+	// MaxSearch is the number of search domains used by the resolver, the rest are ignored.
+	MaxSearch = 6
+
+	// Limits and defaults of the resolver options, see resolv.conf(5).
+	maxNdots        = 15
+	maxTimeout      = 30
+	maxAttempts     = 5
+	defaultNdots    = 1
+	defaultTimeout  = 5 * time.Second
+	defaultAttempts = 2
 )
 
 // Resolver contains the data from resolv.conf
@@ -23,7 +41,12 @@ type ResolverOption struct {
 
 // Config reads /etc/resolv.conf and returns it as a Resolver
 func Config() (Resolver, error) {
-	f, err := os.Open("/etc/resolv.conf")
+	return ConfigFile(DefaultPath)
+}
+
+// ConfigFile reads a resolv.conf file and returns it as a Resolver
+func ConfigFile(path string) (Resolver, error) {
+	f, err := os.Open(path)
 	if err != nil {
 		return Resolver{}, err
 	}
@@ -31,6 +54,19 @@ func Config() (Resolver, error) {
 	return parse(f)
 }
 
+// ParseOption parses an option as written in resolv.conf: name or name:value.
+func ParseOption(s string) ResolverOption {
+	name, value, found := strings.Cut(s, ":")
+	option := ResolverOption{Name: name}
+	if found {
+		option.Value = &value
+	}
+	return option
+}
+
+// parse reads a resolv.conf as described in resolv.conf(5): keywords and values are
+// separated by any whitespace, comments start with # or ;, and the last domain or
+// search line wins since they are mutually exclusive.
 func parse(f io.Reader) (Resolver, error) {
 	domains := make([]string, 0)
 	nameservers := make([]string, 0)
@@ -41,11 +77,11 @@ func parse(f io.Reader) (Resolver, error) {
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
 		line := scanner.Text()
-		if strings.HasPrefix(line, "#") {
-			continue
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
 		}
 
-		parts := strings.Split(line, " ")
+		parts := strings.Fields(line)
 		if len(parts) < 2 {
 			continue
 		}
@@ -55,48 +91,27 @@ func parse(f io.Reader) (Resolver, error) {
 
 		switch kind {
 		case "domain":
-			for _, d := range rest {
-				d := strings.TrimSpace(d)
-				if d != "" {
-					domains = append(domains, d)
-				}
-			}
+			domains = []string{rest[0]}
+			search = make([]string, 0)
 		case "nameserver":
-			n := strings.Join(rest, "")
-			n = strings.TrimSpace(n)
-			nameservers = append(nameservers, n)
+			nameservers = append(nameservers, rest[0])
 		case "search":
-			for _, s := range rest {
-				s := strings.TrimSpace(s)
-				if s != "" {
-					search = append(search, s)
-				}
+			if len(rest) > MaxSearch {
+				rest = rest[:MaxSearch]
 			}
+			search = append(make([]string, 0, len(rest)), rest...)
+			domains = make([]string, 0)
 		case "options":
 			for _, s := range rest {
-				s := strings.TrimSpace(s)
-				s_parts := strings.SplitN(s, ":", 2)
-
-				option := ResolverOption{
-					Name: s_parts[0],
-				}
-				if len(s_parts) == 2 {
-					option.Value = &s_parts[1]
-				}
-
-				if s != "" {
-					options = append(options, option)
-				}
+				options = append(options, ParseOption(s))
 			}
 		case "sortlist":
-			for _, s := range rest {
-				s := strings.TrimSpace(s)
-				if s != "" {
-					sortlist = append(sortlist, s)
-				}
-			}
+			sortlist = append(sortlist, rest...)
 		}
 	}
+	if err := scanner.Err(); err != nil {
+		return Resolver{}, err
+	}
 
 	return Resolver{
 		Domains:     domains,
@@ -106,3 +121,58 @@ func parse(f io.Reader) (Resolver, error) {
 		Sortlist:    sortlist,
 	}, nil
 }
+
+// Option returns the value of the last option with this name, and whether it is set.
+func (r Resolver) Option(name string) (*string, bool) {
+	for i := len(r.Options) - 1; i >= 0; i-- {
+		if r.Options[i].Name == name {
+			return r.Options[i].Value, true
+		}
+	}
+	return nil, false
+}
+
+// intOption returns the value of an integer option capped to max, or def when it is
+// not set or not a number.
+func (r Resolver) intOption(name string, def int, max int) int {
+	value, ok := r.Option(name)
+	if !ok || value == nil {
+		return def
+	}
+	n, err := strconv.Atoi(*value)
+	if err != nil || n < 0 {
+		return def
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// Ndots is the number of dots a name needs to be tried as absolute first.
+func (r Resolver) Ndots() int {
+	return r.intOption("ndots", defaultNdots, maxNdots)
+}
+
+// Timeout is how long to wait for a nameserver before trying the next one.
+func (r Resolver) Timeout() time.Duration {
+	seconds := r.intOption("timeout", int(defaultTimeout/time.Second), maxTimeout)
+	return time.Duration(seconds) * time.Second
+}
+
+// Attempts is how many times the nameservers are queried before giving up.
+func (r Resolver) Attempts() int {
+	return r.intOption("attempts", defaultAttempts, maxAttempts)
+}
+
+// Rotate tells if the queries are spread among the nameservers.
+func (r Resolver) Rotate() bool {
+	_, ok := r.Option("rotate")
+	return ok
+}
+
+// EDNS0 tells if the EDNS0 extensions are enabled.
+func (r Resolver) EDNS0() bool {
+	_, ok := r.Option("edns0")
+	return ok
+}
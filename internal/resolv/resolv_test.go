@@ -0,0 +1,200 @@
+package resolv
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		conf   string
+		expRes Resolver
+	}{
+		"Kubernetes resolv.conf": {
+			conf: `search media.svc.cluster.local svc.cluster.local cluster.local
+nameserver 10.43.0.10
+options ndots:5
+`,
+			expRes: Resolver{
+				Domains:     []string{},
+				Nameservers: []string{"10.43.0.10"},
+				Search:      []string{"media.svc.cluster.local", "svc.cluster.local", "cluster.local"},
+				Sortlist:    []string{},
+				Options:     []ResolverOption{{Name: "ndots", Value: strPtr("5")}},
+			},
+		},
+		"Tabs and indentation": {
+			conf: "nameserver\t1.1.1.1\n  nameserver   8.8.8.8  \n\tsearch\tlan  home\n",
+			expRes: Resolver{
+				Domains:     []string{},
+				Nameservers: []string{"1.1.1.1", "8.8.8.8"},
+				Search:      []string{"lan", "home"},
+				Sortlist:    []string{},
+				Options:     []ResolverOption{},
+			},
+		},
+		"Comments": {
+			conf: `# generated
+; by hand
+nameserver 1.1.1.1 # cloudflare
+nameserver 8.8.8.8; google
+options rotate ;edns0
+`,
+			expRes: Resolver{
+				Domains:     []string{},
+				Nameservers: []string{"1.1.1.1", "8.8.8.8"},
+				Search:      []string{},
+				Sortlist:    []string{},
+				Options:     []ResolverOption{{Name: "rotate"}},
+			},
+		},
+		"Nameserver takes the first word": {
+			conf: "nameserver 1.1.1.1 extra\n",
+			expRes: Resolver{
+				Domains:     []string{},
+				Nameservers: []string{"1.1.1.1"},
+				Search:      []string{},
+				Sortlist:    []string{},
+				Options:     []ResolverOption{},
+			},
+		},
+		"Last search wins": {
+			conf: "search a.example b.example\nsearch c.example\n",
+			expRes: Resolver{
+				Domains:     []string{},
+				Nameservers: []string{},
+				Search:      []string{"c.example"},
+				Sortlist:    []string{},
+				Options:     []ResolverOption{},
+			},
+		},
+		"Domain after search wins": {
+			conf: "search a.example b.example\ndomain c.example\n",
+			expRes: Resolver{
+				Domains:     []string{"c.example"},
+				Nameservers: []string{},
+				Search:      []string{},
+				Sortlist:    []string{},
+				Options:     []ResolverOption{},
+			},
+		},
+		"Search after domain wins": {
+			conf: "domain c.example\nsearch a.example\n",
+			expRes: Resolver{
+				Domains:     []string{},
+				Nameservers: []string{},
+				Search:      []string{"a.example"},
+				Sortlist:    []string{},
+				Options:     []ResolverOption{},
+			},
+		},
+		"Search limited to six domains": {
+			conf: "search a b c d e f g h\n",
+			expRes: Resolver{
+				Domains:     []string{},
+				Nameservers: []string{},
+				Search:      []string{"a", "b", "c", "d", "e", "f"},
+				Sortlist:    []string{},
+				Options:     []ResolverOption{},
+			},
+		},
+		"Options and sortlist": {
+			conf: "options ndots:2 timeout:3\noptions edns0\nsortlist 130.155.160.0/255.255.240.0 130.155.0.0\n",
+			expRes: Resolver{
+				Domains:     []string{},
+				Nameservers: []string{},
+				Search:      []string{},
+				Sortlist:    []string{"130.155.160.0/255.255.240.0", "130.155.0.0"},
+				Options: []ResolverOption{
+					{Name: "ndots", Value: strPtr("2")},
+					{Name: "timeout", Value: strPtr("3")},
+					{Name: "edns0"},
+				},
+			},
+		},
+		"Keywords without values and unknown keywords": {
+			conf: "nameserver\nsearch\nlookup file bind\n",
+			expRes: Resolver{
+				Domains:     []string{},
+				Nameservers: []string{},
+				Search:      []string{},
+				Sortlist:    []string{},
+				Options:     []ResolverOption{},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			res, err := parse(strings.NewReader(test.conf))
+			require.NoError(t, err)
+			assert.Equal(t, test.expRes, res)
+		})
+	}
+}
+
+func TestOptions(t *testing.T) {
+	tests := map[string]struct {
+		conf        string
+		expNdots    int
+		expTimeout  time.Duration
+		expAttempts int
+		expRotate   bool
+		expEDNS0    bool
+	}{
+		"Defaults": {
+			conf:        "nameserver 1.1.1.1\n",
+			expNdots:    1,
+			expTimeout:  5 * time.Second,
+			expAttempts: 2,
+		},
+		"Set": {
+			conf:        "options ndots:5 timeout:1 attempts:3 rotate edns0\n",
+			expNdots:    5,
+			expTimeout:  time.Second,
+			expAttempts: 3,
+			expRotate:   true,
+			expEDNS0:    true,
+		},
+		"Last option wins": {
+			conf:        "options ndots:5\noptions ndots:2\n",
+			expNdots:    2,
+			expTimeout:  5 * time.Second,
+			expAttempts: 2,
+		},
+		"Capped": {
+			conf:        "options ndots:20 timeout:60 attempts:10\n",
+			expNdots:    15,
+			expTimeout:  30 * time.Second,
+			expAttempts: 5,
+		},
+		"Invalid values use the defaults": {
+			conf:        "options ndots:many timeout attempts:-1\n",
+			expNdots:    1,
+			expTimeout:  5 * time.Second,
+			expAttempts: 2,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			res, err := parse(strings.NewReader(test.conf))
+			require.NoError(t, err)
+			assert.Equal(test.expNdots, res.Ndots())
+			assert.Equal(test.expTimeout, res.Timeout())
+			assert.Equal(test.expAttempts, res.Attempts())
+			assert.Equal(test.expRotate, res.Rotate())
+			assert.Equal(test.expEDNS0, res.EDNS0())
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package resolv
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// WriteTo writes the resolver in resolv.conf format: the nameservers, then the search
+// list (or the domain when there is none), the sortlist and the options, each in the
+// order of the resolver.
+func (r Resolver) WriteTo(w io.Writer) (int64, error) {
+	var out bytes.Buffer
+	for _, nameserver := range r.Nameservers {
+		out.WriteString("nameserver " + nameserver + "\n")
+	}
+	switch {
+	case len(r.Search) > 0:
+		out.WriteString("search " + strings.Join(r.Search, " ") + "\n")
+	case len(r.Domains) > 0:
+		out.WriteString("domain " + r.Domains[len(r.Domains)-1] + "\n")
+	}
+	if len(r.Sortlist) > 0 {
+		out.WriteString("sortlist " + strings.Join(r.Sortlist, " ") + "\n")
+	}
+	if len(r.Options) > 0 {
+		options := make([]string, 0, len(r.Options))
+		for _, option := range r.Options {
+			if option.Value != nil {
+				options = append(options, option.Name+":"+*option.Value)
+			} else {
+				options = append(options, option.Name)
+			}
+		}
+		out.WriteString("options " + strings.Join(options, " ") + "\n")
+	}
+	return out.WriteTo(w)
+}
+
+// String returns the resolver in resolv.conf format.
+func (r Resolver) String() string {
+	var out strings.Builder
+	r.WriteTo(&out)
+	return out.String()
+}
+
+// PodDNSConfig converts the resolver to a pod DNS config. The domain is used as search
+// list when there is none, like the resolver does.
+func (r Resolver) PodDNSConfig() corev1.PodDNSConfig {
+	searches := r.Search
+	if len(searches) == 0 && len(r.Domains) > 0 {
+		searches = r.Domains[len(r.Domains)-1:]
+	}
+
+	options := make([]corev1.PodDNSConfigOption, 0, len(r.Options))
+	for _, option := range r.Options {
+		options = append(options, corev1.PodDNSConfigOption{
+			Name:  option.Name,
+			Value: option.Value,
+		})
+	}
+
+	return corev1.PodDNSConfig{
+		Nameservers: r.Nameservers,
+		Searches:    searches,
+		Options:     options,
+	}
+}
+
+// FromPodDNSConfig converts a pod DNS config to a resolver. The resolver shares nothing
+// with the config, so changing it does not change the config.
+func FromPodDNSConfig(config corev1.PodDNSConfig) Resolver {
+	options := make([]ResolverOption, 0, len(config.Options))
+	for _, option := range config.Options {
+		var value *string
+		if option.Value != nil {
+			copied := *option.Value
+			value = &copied
+		}
+		options = append(options, ResolverOption{
+			Name:  option.Name,
+			Value: value,
+		})
+	}
+
+	return Resolver{
+		Domains:     make([]string, 0),
+		Nameservers: append(make([]string, 0, len(config.Nameservers)), config.Nameservers...),
+		Search:      append(make([]string, 0, len(config.Searches)), config.Searches...),
+		Sortlist:    make([]string, 0),
+		Options:     options,
+	}
+}
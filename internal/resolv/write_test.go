@@ -0,0 +1,118 @@
+package resolv
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestWrite(t *testing.T) {
+	tests := map[string]struct {
+		res     Resolver
+		expConf string
+	}{
+		"Empty": {
+			res:     Resolver{},
+			expConf: "",
+		},
+		"Full": {
+			res: Resolver{
+				Domains:     []string{"ignored.example"},
+				Nameservers: []string{"10.43.0.10", "1.1.1.1"},
+				Search:      []string{"media.svc.cluster.local", "svc.cluster.local"},
+				Sortlist:    []string{"130.155.160.0/255.255.240.0"},
+				Options:     []ResolverOption{{Name: "ndots", Value: strPtr("5")}, {Name: "edns0"}, {Name: "empty", Value: strPtr("")}},
+			},
+			expConf: `nameserver 10.43.0.10
+nameserver 1.1.1.1
+search media.svc.cluster.local svc.cluster.local
+sortlist 130.155.160.0/255.255.240.0
+options ndots:5 edns0 empty:
+`,
+		},
+		"Domain without search": {
+			res:     Resolver{Domains: []string{"lan"}, Nameservers: []string{"192.168.1.1"}},
+			expConf: "nameserver 192.168.1.1\ndomain lan\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			assert.Equal(test.expConf, test.res.String())
+
+			// What is written is read back
+			res, err := parse(strings.NewReader(test.expConf))
+			require.NoError(t, err)
+			assert.Equal(test.expConf, res.String())
+		})
+	}
+}
+
+func TestPodDNSConfigRoundTrip(t *testing.T) {
+	tests := map[string]struct {
+		config corev1.PodDNSConfig
+		conf   string
+	}{
+		"Options with and without values": {
+			config: corev1.PodDNSConfig{
+				Nameservers: []string{"1.1.1.1"},
+				Searches:    []string{"media.svc.cluster.local", "svc.cluster.local"},
+				Options: []corev1.PodDNSConfigOption{
+					{Name: "ndots", Value: strPtr("2")},
+					{Name: "rotate"},
+					{Name: "empty", Value: strPtr("")},
+				},
+			},
+			conf: "nameserver 1.1.1.1\nsearch media.svc.cluster.local svc.cluster.local\noptions ndots:2 rotate empty:\n",
+		},
+		"Nameservers only": {
+			config: corev1.PodDNSConfig{
+				Nameservers: []string{"1.1.1.1", "8.8.8.8"},
+				Searches:    []string{},
+				Options:     []corev1.PodDNSConfigOption{},
+			},
+			conf: "nameserver 1.1.1.1\nnameserver 8.8.8.8\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			res := FromPodDNSConfig(test.config)
+			assert.Equal(test.config, res.PodDNSConfig())
+			assert.Equal(test.conf, res.String())
+
+			parsed, err := parse(strings.NewReader(test.conf))
+			require.NoError(err)
+			assert.Equal(test.config, parsed.PodDNSConfig())
+		})
+	}
+}
+
+func TestFromPodDNSConfigCopies(t *testing.T) {
+	config := corev1.PodDNSConfig{
+		Nameservers: []string{"1.1.1.1"},
+		Searches:    []string{"svc.cluster.local"},
+		Options:     []corev1.PodDNSConfigOption{{Name: "ndots", Value: strPtr("2")}},
+	}
+	expConfig := *config.DeepCopy()
+
+	res := FromPodDNSConfig(config)
+	res.Nameservers[0] = "8.8.8.8"
+	res.Search[0] = "lan"
+	*res.Options[0].Value = "5"
+
+	assert.Equal(t, expConfig, config)
+}
+
+func TestPodDNSConfigDomain(t *testing.T) {
+	res := Resolver{Domains: []string{"lan"}, Nameservers: []string{"192.168.1.1"}}
+	assert.Equal(t, []string{"lan"}, res.PodDNSConfig().Searches)
+}
@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	// ExporterNone disables tracing.
+	ExporterNone = "none"
+	// ExporterStdout writes the spans to stdout, for local debugging.
+	ExporterStdout = "stdout"
+	// ExporterOTLP sends the spans to an OTLP/HTTP collector.
+	ExporterOTLP = "otlp"
+)
+
+// Config is the tracing configuration.
+type Config struct {
+	Exporter string
+	// OTLPEndpoint is the host:port of the collector. The OTEL_EXPORTER_OTLP_* env are used when empty.
+	OTLPEndpoint string
+	OTLPInsecure bool
+	// SampleRatio of the traces not sampled by the caller (the API server).
+	SampleRatio float64
+	ServiceName string
+	Version     string
+}
+
+func (c *Config) defaults() error {
+
+	if c.Exporter == "" {
+		c.Exporter = ExporterNone
+	}
+
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return fmt.Errorf("sample ratio %v must be between 0 and 1", c.SampleRatio)
+	}
+
+	if c.ServiceName == "" {
+		c.ServiceName = "gateway-admision-controller"
+	}
+
+	return nil
+}
+
+// Provider is the tracer provider and its shutdown, which flushes the pending spans.
+type Provider struct {
+	oteltrace.TracerProvider
+	Shutdown func(ctx context.Context) error
+}
+
+// Propagator extracts and injects the W3C trace context.
+var Propagator propagation.TextMapPropagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+// New returns the tracer provider of the configured exporter and sets it as the global one.
+func New(ctx context.Context, config Config) (*Provider, error) {
+	err := config.defaults()
+	if err != nil {
+		return nil, fmt.Errorf("tracing configuration is not valid: %w", err)
+	}
+
+	var exporter sdktrace.SpanExporter
+	switch config.Exporter {
+	case ExporterNone:
+		return &Provider{
+			TracerProvider: noop.NewTracerProvider(),
+			Shutdown:       func(context.Context) error { return nil },
+		}, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if config.OTLPEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(config.OTLPEndpoint))
+		}
+		if config.OTLPInsecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("invalid tracing exporter %q", config.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not create the %s trace exporter: %w", config.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", config.ServiceName),
+		attribute.String("service.version", config.Version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("could not create the trace resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		// Follow the API server decision when it sends a trace context.
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(Propagator)
+
+	return &Provider{
+		TracerProvider: tp,
+		Shutdown:       tp.Shutdown,
+	}, nil
+}